@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/ratelimit"
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// gin context keys holding the caller's tenant and API key ID
+const (
+	tenantKey   = "tenant"
+	apiKeyIDKey = "api_key_id"
+)
+
+// authenticate requires a bearer API key on every request and records the
+// key's tenant in the context. With AUTH_REQUIRED=false every caller is
+// the anonymous tenant, and shares its usage, quota and rate limit.
+func (s *server) authenticate(c *gin.Context) {
+	if !s.cfg.AuthRequired {
+		c.Set(tenantKey, storage.AnonymousTenant)
+		c.Set(apiKeyIDKey, storage.AnonymousTenant)
+		c.Next()
+		return
+	}
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	token = strings.TrimSpace(token)
+	if !ok || token == "" {
+		unauthorized(c, "Missing bearer API key")
+		return
+	}
+	key, err := s.store.LookupAPIKey(storage.HashAPIKey(token))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to check API key: %v", err)})
+		return
+	}
+	if key == nil || key.Revoked() {
+		unauthorized(c, "Invalid API key")
+		return
+	}
+	c.Set(tenantKey, key.Tenant)
+	c.Set(apiKeyIDKey, key.ID)
+	c.Next()
+}
+
+// unauthorized rejects the request with a 401
+func unauthorized(c *gin.Context, message string) {
+	c.Header("WWW-Authenticate", `Bearer realm="ai_agents_wrapper"`)
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": message})
+}
+
+// tenant returns the tenant of the authenticated caller
+func tenant(c *gin.Context) string {
+	return c.GetString(tenantKey)
+}
+
+// ownedTask fetches a task for the caller, answering 404 (so task IDs of
+// other tenants are not revealed) or 500 itself and returning nil when
+// the caller may not see it
+func (s *server) ownedTask(c *gin.Context, taskID string) *storage.Task {
+	task, err := s.store.GetTask(taskID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to fetch task: %v", err)})
+		return nil
+	}
+	if task == nil || (s.cfg.AuthRequired && task.Tenant != tenant(c)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		return nil
+	}
+	return task
+}
+
+// limitRate applies the API key's token bucket to submissions, answering
+// 429 with Retry-After when it is empty
+func (s *server) limitRate(c *gin.Context) {
+	if s.cfg.RateLimit <= 0 {
+		return
+	}
+	wait, err := s.limiter.Take(ratelimit.Bucket{
+		Key:   "ratelimit:key:" + c.GetString(apiKeyIDKey),
+		Rate:  s.cfg.RateLimit,
+		Burst: float64(s.cfg.RateLimitBurst),
+		Cost:  1,
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if wait > 0 {
+		tooManyRequests(c, wait, "Rate limit exceeded")
+	}
+}
+
+// limitQuota applies the tenant's daily and monthly quotas to requests
+// answered inline, answering 429 with Retry-After when one is used up.
+// Requests that fail are not counted. Queued tasks are charged by enqueue
+// instead, so that idempotent replays are free.
+func (s *server) limitQuota(c *gin.Context) {
+	if err := s.useQuota(tenant(c)); err != nil {
+		quotaFailed(c, err)
+		return
+	}
+	c.Next()
+	if c.Writer.Status() >= 400 {
+		s.refundQuota(tenant(c))
+	}
+}
+
+// quotaError is returned when a tenant's quota for period is used up
+type quotaError struct {
+	period string
+	wait   time.Duration
+}
+
+func (e *quotaError) Error() string {
+	return fmt.Sprintf("The %s quota for this tenant is used up", e.period)
+}
+
+// useQuota counts one submission against tenant's quota
+func (s *server) useQuota(tenant string) error {
+	period, wait, err := s.limiter.UseQuota(tenant, s.cfg.QuotaFor(tenant))
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		return &quotaError{period: period, wait: wait}
+	}
+	return nil
+}
+
+// refundQuota gives back a submission counted by useQuota
+func (s *server) refundQuota(tenant string) {
+	if err := s.limiter.RefundQuota(tenant, s.cfg.QuotaFor(tenant)); err != nil {
+		log.Printf("Failed to refund quota of tenant %q: %v", tenant, err)
+	}
+}
+
+// quotaFailed answers a useQuota error: 429 with Retry-After when the
+// quota is used up, 500 otherwise
+func quotaFailed(c *gin.Context, err error) {
+	var qerr *quotaError
+	if errors.As(err, &qerr) {
+		tooManyRequests(c, qerr.wait, qerr.Error())
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// tooManyRequests rejects the request with a 429 telling the caller when to retry
+func tooManyRequests(c *gin.Context, wait time.Duration, message string) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": message})
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/facade"
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newAuthRouter serves GET /v1/tasks/:id and an echo of the caller's
+// tenant from a fresh SQLite store behind authenticate
+func newAuthRouter(t *testing.T, authRequired bool) (*gin.Engine, storage.ResultStore) {
+	t.Helper()
+	store, err := storage.NewSQLStore(storage.DriverSQLite, "file:"+t.TempDir()+"/api.db")
+	if err != nil {
+		t.Fatalf("NewSQLStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	s := &server{cfg: &facade.Config{AuthRequired: authRequired}, store: store}
+	r := gin.New()
+	r.Use(s.authenticate)
+	r.GET("/v1/tasks/:id", s.getTask)
+	r.GET("/whoami", func(c *gin.Context) { c.String(http.StatusOK, tenant(c)) })
+	return r, store
+}
+
+// issueKey stores a new API key for tenant and returns it
+func issueKey(t *testing.T, store storage.KeyStore, tenant string) (string, storage.APIKey) {
+	t.Helper()
+	key, record, err := storage.NewAPIKey(tenant, "")
+	if err != nil {
+		t.Fatalf("NewAPIKey: %v", err)
+	}
+	if err := store.CreateAPIKey(record); err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	return key, record
+}
+
+// get requests path with the given Authorization header, if any
+func get(r http.Handler, path, authorization string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAuthenticate(t *testing.T) {
+	r, store := newAuthRouter(t, true)
+	acmeKey, _ := issueKey(t, store, "acme")
+	revokedKey, revoked := issueKey(t, store, "acme")
+	if err := store.RevokeAPIKey(revoked.ID); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name, authorization string
+		status              int
+	}{
+		{"missing", "", http.StatusUnauthorized},
+		{"wrong scheme", "Basic " + acmeKey, http.StatusUnauthorized},
+		{"empty bearer", "Bearer  ", http.StatusUnauthorized},
+		{"unknown key", "Bearer aiw_0123456789", http.StatusUnauthorized},
+		{"revoked key", "Bearer " + revokedKey, http.StatusUnauthorized},
+		{"valid key", "Bearer " + acmeKey, http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := get(r, "/whoami", tc.authorization)
+			if w.Code != tc.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tc.status, w.Body)
+			}
+			if tc.status == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without a WWW-Authenticate header")
+			}
+			if tc.status == http.StatusOK && w.Body.String() != "acme" {
+				t.Errorf("tenant = %q", w.Body)
+			}
+		})
+	}
+}
+
+func TestAuthenticateDisabled(t *testing.T) {
+	r, _ := newAuthRouter(t, false)
+	if w := get(r, "/whoami", ""); w.Code != http.StatusOK || w.Body.String() != storage.AnonymousTenant {
+		t.Errorf("status = %d, tenant = %q, want %q", w.Code, w.Body, storage.AnonymousTenant)
+	}
+}
+
+func TestTaskLookupIsScopedToTenant(t *testing.T) {
+	r, store := newAuthRouter(t, true)
+	acmeKey, _ := issueKey(t, store, "acme")
+	globexKey, _ := issueKey(t, store, "globex")
+	if err := store.CreateTask("task-1", "acme", facade.Request{Messages: facade.PromptMessages("", "hi")}); err != nil {
+		t.Fatalf("CreateTask: %v", err)
+	}
+
+	if w := get(r, "/v1/tasks/task-1", "Bearer "+acmeKey); w.Code != http.StatusOK {
+		t.Errorf("owner: status = %d: %s", w.Code, w.Body)
+	}
+	other := get(r, "/v1/tasks/task-1", "Bearer "+globexKey)
+	unknown := get(r, "/v1/tasks/task-2", "Bearer "+globexKey)
+	if other.Code != http.StatusNotFound || other.Body.String() != unknown.Body.String() {
+		t.Errorf("other tenant: status = %d, body %s; want the 404 of an unknown task, %s", other.Code, other.Body, unknown.Body)
+	}
+}
@@ -1,15 +1,24 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/budget"
 	"github.com/Rammurthy5/ai_agents_wrapper/internal/facade"
 	"github.com/Rammurthy5/ai_agents_wrapper/internal/queue"
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/ratelimit"
 	"github.com/Rammurthy5/ai_agents_wrapper/internal/storage"
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/worker"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 )
 
 func main() {
@@ -18,57 +27,260 @@ func main() {
 	if err != nil {
 		log.Fatal("Failed to load config:", err)
 	}
+	if err := cfg.RequireBackends(); err != nil {
+		log.Fatal("Failed to load config:", err)
+	}
+
+	// Initialize the queue
+	broker, err := queue.New(cfg)
+	if err != nil {
+		log.Fatal("Failed to initialize queue:", err)
+	}
+	defer broker.Close()
 
-	// Initialize RabbitMQ
-	rabbit, err := queue.NewRabbitMQ(cfg.RABBITMQ_URL)
+	store, err := storage.NewResultStore(cfg)
 	if err != nil {
-		log.Fatal("Failed to initialize RabbitMQ:", err)
+		log.Fatalf("Failed to initialize result store: %v", err)
 	}
-	defer rabbit.Close()
+	defer store.Close()
 
-	redisClient, err := storage.NewRedisClient(cfg.Redis_URL)
+	// Redis carries live progress events whichever store holds results
+	redisClient, err := storage.NewRedisClient(cfg.Redis_URL, cfg.TaskTTL)
 	if err != nil {
 		log.Fatalf("Failed to initialize Redis: %v", err)
 	}
 	defer redisClient.Close()
 
+	// Submission limits and provider limits are shared by all replicas
+	limiter, err := ratelimit.New(cfg.Redis_URL)
+	if err != nil {
+		log.Fatalf("Failed to initialize rate limiter: %v", err)
+	}
+	defer limiter.Close()
+	guard := budget.New(limiter, cfg)
+
+	// The facade answers the OpenAI-compatible endpoints directly; queued
+	// tasks only need it here when the worker runs in-process
+	f, err := facade.NewFacade(cfg)
+	if err != nil {
+		if cfg.QueueBackend == queue.BackendMemory {
+			log.Fatal("Failed to initialize facade:", err)
+		}
+		log.Printf("OpenAI-compatible endpoints disabled: %v", err)
+	} else {
+		f.SetLimiter(limiter.Providers(cfg.ProviderLimits))
+	}
+
+	// The in-process queue can only be drained by a worker in this process
+	if cfg.QueueBackend == queue.BackendMemory {
+		hostname, _ := os.Hostname()
+		w := worker.New(fmt.Sprintf("%s-%d", hostname, os.Getpid()), f, broker, store, redisClient, guard, cfg)
+		go func() {
+			if err := w.Run(context.Background()); err != nil {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	s := &server{cfg: cfg, f: f, broker: broker, store: store, events: redisClient, limiter: limiter, budget: guard}
+
 	// Set up gin router
 	r := gin.Default()
-	r.GET("/getMergedResults", func(c *gin.Context) {
-		prompt := c.Query("prompt")
-		taskID := uuid.New().String()
-		if prompt == "" {
-			c.JSON(400, gin.H{"error": "Missing 'prompt' query parameter"})
+	r.Use(s.authenticate)
+	r.GET("/getMergedResults", s.limitRate, func(c *gin.Context) {
+		messages, err := parseMessages(c)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		opts, err := parseGenerationOptions(c)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		merge, err := parseMergeOptions(c)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
 			return
 		}
 
-		// Enqueue the prompt
-		msg := queue.Message{Prompt: prompt, TaskID: taskID}
-		if err := rabbit.Publish(msg); err != nil {
-			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to enqueue request: %v", err)})
+		// Enqueue the conversation
+		msg := queue.Message{Messages: messages, Options: opts, Merge: merge, Stream: c.Query("stream") == "true", Tenant: tenant(c)}
+		taskID, replayed, err := s.enqueue(msg, c.GetHeader("Idempotency-Key"))
+		if err != nil {
+			enqueueFailed(c, err)
+			return
+		}
+		if replayed {
+			c.JSON(200, gin.H{"message": "Request already queued", "task_id": taskID})
 			return
 		}
 
 		c.JSON(202, gin.H{"message": "Request queued successfully", "task_id": taskID})
 	})
 
+	r.POST("/v1/tasks", s.limitRate, s.createTask)
+	r.GET("/v1/tasks/:id", s.getTask)
+	r.POST("/v1/chat/completions", s.limitRate, s.limitQuota, s.chatCompletions)
+	r.GET("/v1/models", s.listModels)
+	r.GET("/v1/usage", s.getUsage)
+
 	r.GET("/results/:taskID", func(c *gin.Context) {
-		taskID := c.Param("taskID")
-		result, err := redisClient.GetResult(taskID)
-		if err != nil {
-			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to fetch result: %v", err)})
+		task := s.ownedTask(c, c.Param("taskID"))
+		if task == nil {
 			return
 		}
-		if result == nil {
-			c.JSON(404, gin.H{"error": "Result not found or still processing"})
+		if !task.Finished() {
+			c.JSON(202, task)
 			return
 		}
-		c.JSON(200, result)
+		c.JSON(200, task)
 	})
 
+	r.GET("/results/:taskID/stream", s.streamResults)
+
 	// Start server
 	log.Println("API server starting on :8080")
 	if err := r.Run(":8080"); err != nil {
 		log.Fatal(err)
 	}
 }
+
+// parseMessages reads the conversation from the query string: either a
+// 'prompt' with an optional 'system', or 'messages' holding a JSON array
+// of {"role","content"} turns
+func parseMessages(c *gin.Context) ([]facade.ChatMessage, error) {
+	var messages []facade.ChatMessage
+	if raw := c.Query("messages"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &messages); err != nil {
+			return nil, fmt.Errorf("invalid 'messages': %v", err)
+		}
+	} else {
+		prompt := c.Query("prompt")
+		if prompt == "" {
+			return nil, fmt.Errorf("Missing 'prompt' query parameter")
+		}
+		messages = facade.PromptMessages(c.Query("system"), prompt)
+	}
+	if err := facade.ValidateMessages(messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// parseMergeOptions reads the merge 'strategy' and, for fastest-n, 'n'
+func parseMergeOptions(c *gin.Context) (facade.MergeOptions, error) {
+	merge := facade.MergeOptions{Strategy: strings.ToLower(c.Query("strategy"))}
+	if v := c.Query("n"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return merge, fmt.Errorf("invalid 'n': %v", err)
+		}
+		merge.N = n
+	}
+	return merge, merge.Validate()
+}
+
+// parseGenerationOptions reads generation parameters from the query string:
+// temperature, top_p, max_tokens, seed, repeated stop, and per-provider
+// models as model[openai]=gpt-4o
+func parseGenerationOptions(c *gin.Context) (facade.GenerationOptions, error) {
+	var opts facade.GenerationOptions
+	if models := c.QueryMap("model"); len(models) > 0 {
+		opts.Models = make(map[string]string, len(models))
+		for provider, model := range models {
+			opts.Models[strings.ToLower(provider)] = model
+		}
+	}
+	if v := c.Query("temperature"); v != "" {
+		t, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return opts, fmt.Errorf("invalid 'temperature': %v", err)
+		}
+		opts.Temperature = &t
+	}
+	if v := c.Query("top_p"); v != "" {
+		p, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return opts, fmt.Errorf("invalid 'top_p': %v", err)
+		}
+		opts.TopP = &p
+	}
+	if v := c.Query("max_tokens"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid 'max_tokens': %v", err)
+		}
+		opts.MaxTokens = n
+	}
+	if v := c.Query("seed"); v != "" {
+		seed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return opts, fmt.Errorf("invalid 'seed': %v", err)
+		}
+		opts.Seed = &seed
+	}
+	opts.Stop = c.QueryArray("stop")
+	return opts, opts.Validate()
+}
+
+// streamResults serves a task's progress as Server-Sent Events: a
+// "result" event per provider, "delta" events for streaming tasks, and a
+// final "done" (or "failed") event with the merged result, after which it closes
+func (s *server) streamResults(c *gin.Context) {
+	taskID := c.Param("taskID")
+	ctx := c.Request.Context()
+
+	// Subscribe before checking storage so a result stored in between
+	// cannot be missed
+	events, err := s.events.SubscribeEvents(ctx, taskID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to subscribe: %v", err)})
+		return
+	}
+	task := s.ownedTask(c, taskID)
+	if task == nil {
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	switch task.Status {
+	case storage.StatusDone:
+		c.SSEvent(storage.EventDone, storage.TaskEvent{Type: storage.EventDone, TaskID: taskID, Merged: task.Result})
+		return
+	case storage.StatusFailed:
+		c.SSEvent(storage.EventFailed, storage.TaskEvent{Type: storage.EventFailed, TaskID: taskID, Merged: task.Result, Error: task.Error})
+		return
+	}
+	// Replay provider results that arrived before the subscription; the
+	// same results may also come through the subscription, so skip those
+	replayed := make(map[string]bool)
+	for i := range task.Partial {
+		replayed[task.Partial[i].Source] = true
+		c.SSEvent(storage.EventResult, storage.TaskEvent{Type: storage.EventResult, TaskID: taskID, Source: task.Partial[i].Source, Result: &task.Partial[i]})
+	}
+
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return false
+			}
+			if ev.Type == storage.EventResult && replayed[ev.Source] {
+				return true
+			}
+			c.SSEvent(ev.Type, ev)
+			return !ev.Final()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	})
+}
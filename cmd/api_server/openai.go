@@ -0,0 +1,331 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/facade"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// mergedModelPrefix marks virtual models that run the multi-provider merge,
+// e.g. merged/consensus
+const mergedModelPrefix = "merged/"
+
+// mergeStrategies are offered as merged/<strategy> models
+var mergeStrategies = []string{
+	facade.StrategyAll,
+	facade.StrategyFirstSuccessful,
+	facade.StrategyFastestN,
+	facade.StrategyConsensus,
+	facade.StrategyJudge,
+}
+
+// chatCompletionRequest is the subset of OpenAI's chat completion request
+// the wrapper understands
+type chatCompletionRequest struct {
+	Model       string        `json:"model"`
+	Messages    []chatMessage `json:"messages"`
+	Temperature *float64      `json:"temperature"`
+	TopP        *float64      `json:"top_p"`
+	MaxTokens   int           `json:"max_tokens"`
+	Stop        stopList      `json:"stop"`
+	Seed        *int64        `json:"seed"`
+	Stream      bool          `json:"stream"`
+}
+
+// chatMessage is one OpenAI message; content may be a string or a list of
+// parts, of which only text parts are kept
+type chatMessage struct {
+	Role    string      `json:"role"`
+	Content chatContent `json:"content"`
+}
+
+// chatContent is message text flattened from either content form
+type chatContent string
+
+func (c *chatContent) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*c = chatContent(s)
+		return nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return fmt.Errorf("content must be a string or a list of parts")
+	}
+	var text strings.Builder
+	for _, p := range parts {
+		if p.Type == "text" {
+			text.WriteString(p.Text)
+		}
+	}
+	*c = chatContent(text.String())
+	return nil
+}
+
+// stopList accepts OpenAI's stop as either one string or a list
+type stopList []string
+
+func (s *stopList) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*s = stopList{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return fmt.Errorf("stop must be a string or a list of strings")
+	}
+	*s = many
+	return nil
+}
+
+// chatCompletion is an OpenAI chat completion, or one chunk of a streamed one
+type chatCompletion struct {
+	ID      string       `json:"id"`
+	Object  string       `json:"object"`
+	Created int64        `json:"created"`
+	Model   string       `json:"model"`
+	Choices []chatChoice `json:"choices"`
+	Usage   *chatUsage   `json:"usage,omitempty"`
+}
+
+// chatUsage is OpenAI's token usage block, summed over every provider call
+type chatUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// chatChoice carries a whole Message, or a Delta when streaming
+type chatChoice struct {
+	Index        int        `json:"index"`
+	Message      *chatReply `json:"message,omitempty"`
+	Delta        *chatReply `json:"delta,omitempty"`
+	FinishReason *string    `json:"finish_reason"`
+}
+
+// chatReply is the assistant's message, or a piece of it
+type chatReply struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+// openAIError writes an error in OpenAI's error schema
+func openAIError(c *gin.Context, status int, kind, message string) {
+	c.JSON(status, gin.H{"error": gin.H{"message": message, "type": kind, "param": nil, "code": nil}})
+}
+
+// listModels handles GET /v1/models: one model per enabled provider, which
+// uses that provider's default model, plus a merged/<strategy> model per
+// merge strategy
+func (s *server) listModels(c *gin.Context) {
+	var models []gin.H
+	for _, p := range s.cfg.Providers {
+		models = append(models, gin.H{"id": p, "object": "model", "created": 0, "owned_by": p})
+	}
+	for _, strategy := range mergeStrategies {
+		if strategy == facade.StrategyJudge && s.cfg.JudgeProvider == "" {
+			continue
+		}
+		models = append(models, gin.H{"id": mergedModelPrefix + strategy, "object": "model", "created": 0, "owned_by": "ai_agents_wrapper"})
+	}
+	c.JSON(http.StatusOK, gin.H{"object": "list", "data": models})
+}
+
+// chatCompletions handles POST /v1/chat/completions. A model of
+// provider/model (or just provider) calls that one provider; merged/<strategy>
+// calls every provider and answers with the merge's output, or with one
+// choice per successful provider for merged/all.
+func (s *server) chatCompletions(c *gin.Context) {
+	if s.f == nil {
+		openAIError(c, http.StatusServiceUnavailable, "server_error", "no providers are available on this server")
+		return
+	}
+	var body chatCompletionRequest
+	if err := json.NewDecoder(http.MaxBytesReader(c.Writer, c.Request.Body, s.cfg.MaxBodyBytes)).Decode(&body); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			openAIError(c, http.StatusRequestEntityTooLarge, "invalid_request_error", fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit))
+			return
+		}
+		openAIError(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("invalid JSON body: %v", err))
+		return
+	}
+
+	req := facade.Request{Options: facade.GenerationOptions{
+		Temperature: body.Temperature,
+		TopP:        body.TopP,
+		MaxTokens:   body.MaxTokens,
+		Stop:        body.Stop,
+		Seed:        body.Seed,
+	}}
+	for _, m := range body.Messages {
+		req.Messages = append(req.Messages, facade.ChatMessage{Role: m.Role, Content: string(m.Content)})
+	}
+	if strategy, ok := strings.CutPrefix(body.Model, mergedModelPrefix); ok {
+		req.Merge.Strategy = strings.ToLower(strategy)
+	} else {
+		provider, model, _ := strings.Cut(body.Model, "/")
+		if provider == "" || !s.providerEnabled(provider) {
+			openAIError(c, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("The model %q does not exist", body.Model))
+			return
+		}
+		req.Providers = []string{provider}
+		if model != "" {
+			req.Options.Models = map[string]string{strings.ToLower(provider): model}
+		}
+	}
+	if err := req.Validate(); err != nil {
+		openAIError(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	req, err := s.budget.Check(s.f, tenant(c), req)
+	if errors.Is(err, facade.ErrOverBudget) {
+		openAIError(c, http.StatusTooManyRequests, "insufficient_quota", err.Error())
+		return
+	}
+	if err != nil {
+		openAIError(c, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	completion := chatCompletion{
+		ID:      "chatcmpl-" + uuid.New().String(),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   body.Model,
+	}
+	if body.Stream && len(req.Providers) == 1 {
+		s.streamCompletion(c, req, completion)
+		return
+	}
+
+	result := s.f.GetMergedResults(c.Request.Context(), req)
+	s.recordUsage(c, result)
+	if len(req.Providers) == 1 || req.Merge.Strategy == facade.StrategyAll {
+		for _, r := range result.Results {
+			if r.Error != "" {
+				continue
+			}
+			reason := finishReason(r)
+			completion.Choices = append(completion.Choices, chatChoice{
+				Index:        len(completion.Choices),
+				Message:      &chatReply{Role: facade.RoleAssistant, Content: r.Message},
+				FinishReason: &reason,
+			})
+		}
+	} else if result.Output != "" {
+		reason := "stop"
+		completion.Choices = []chatChoice{{Message: &chatReply{Role: facade.RoleAssistant, Content: result.Output}, FinishReason: &reason}}
+	}
+	if len(completion.Choices) == 0 {
+		openAIError(c, http.StatusBadGateway, "upstream_error", failureMessage(result))
+		return
+	}
+
+	if !body.Stream {
+		u := result.Usage
+		completion.Usage = &chatUsage{PromptTokens: u.InputTokens, CompletionTokens: u.OutputTokens, TotalTokens: u.InputTokens + u.OutputTokens}
+		c.JSON(http.StatusOK, completion)
+		return
+	}
+	// Merged answers are only known once every provider is in, so they
+	// stream as a single chunk per choice
+	startStream(c)
+	completion.Object = "chat.completion.chunk"
+	for _, choice := range completion.Choices {
+		choice.Delta, choice.Message = choice.Message, nil
+		writeChunk(c, completion, choice)
+	}
+	endStream(c)
+}
+
+// streamCompletion relays one provider's token stream as OpenAI chunks
+func (s *server) streamCompletion(c *gin.Context, req facade.Request, completion chatCompletion) {
+	completion.Object = "chat.completion.chunk"
+	startStream(c)
+	writeChunk(c, completion, chatChoice{Delta: &chatReply{Role: facade.RoleAssistant}})
+	var results []facade.ApiResponse
+	for ev := range s.f.Stream(c.Request.Context(), req) {
+		if ev.Done && ev.Response != nil {
+			results = append(results, *ev.Response)
+		}
+		switch {
+		case ev.Delta != "":
+			writeChunk(c, completion, chatChoice{Delta: &chatReply{Content: ev.Delta}})
+		case ev.Done && ev.Error != "":
+			data, _ := json.Marshal(gin.H{"error": gin.H{"message": fmt.Sprintf("%s failed: %s", ev.Source, ev.Error), "type": "upstream_error"}})
+			fmt.Fprintf(c.Writer, "data: %s\n\n", data)
+		case ev.Done:
+			reason := finishReason(*ev.Response)
+			writeChunk(c, completion, chatChoice{Delta: &chatReply{}, FinishReason: &reason})
+		}
+	}
+	endStream(c)
+	s.recordUsage(c, facade.MergedApiResponse{Results: results})
+}
+
+// startStream sends the headers of an SSE response
+func startStream(c *gin.Context) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+}
+
+// writeChunk sends completion with the single given choice as one SSE data line
+func writeChunk(c *gin.Context, completion chatCompletion, choice chatChoice) {
+	completion.Choices = []chatChoice{choice}
+	data, _ := json.Marshal(completion)
+	fmt.Fprintf(c.Writer, "data: %s\n\n", data)
+	c.Writer.Flush()
+}
+
+// endStream sends OpenAI's end-of-stream marker
+func endStream(c *gin.Context) {
+	fmt.Fprint(c.Writer, "data: [DONE]\n\n")
+	c.Writer.Flush()
+}
+
+// finishReason maps a provider's stop reason onto OpenAI's values
+func finishReason(r facade.ApiResponse) string {
+	if r.Safety != nil {
+		return "content_filter"
+	}
+	switch strings.ToLower(r.FinishReason) {
+	case "length", "max_tokens":
+		return "length"
+	case "safety", "content_filter", "recitation":
+		return "content_filter"
+	}
+	return "stop"
+}
+
+// failureMessage explains why a merged result produced no answer
+func failureMessage(result facade.MergedApiResponse) string {
+	var failures []string
+	for _, r := range result.Results {
+		if r.Error != "" {
+			failures = append(failures, fmt.Sprintf("%s: %s", r.Source, r.Error))
+		}
+	}
+	if len(failures) == 0 && result.Rationale != "" {
+		return result.Rationale
+	}
+	if len(failures) == 0 {
+		return "no provider answered"
+	}
+	return "no provider succeeded (" + strings.Join(failures, "; ") + ")"
+}
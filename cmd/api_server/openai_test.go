@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/budget"
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/facade"
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// stubClient answers with its source and the model it was asked for, as
+// separate deltas when streaming, using 3 input and 2 output tokens. With
+// fail set it reports an error.
+type stubClient struct {
+	source string
+	model  string
+	fail   bool
+}
+
+func (c *stubClient) Source() string { return c.source }
+
+func (c *stubClient) Call(ctx context.Context, req facade.Request) facade.ApiResponse {
+	if c.fail {
+		return facade.ApiResponse{Source: c.source, Error: "status 500"}
+	}
+	return facade.ApiResponse{Source: c.source, Message: strings.Join(c.deltas(req), ""), FinishReason: "stop",
+		Usage: &facade.Usage{InputTokens: 3, OutputTokens: 2}}
+}
+
+func (c *stubClient) Stream(ctx context.Context, req facade.Request) (<-chan facade.StreamEvent, error) {
+	resp := c.Call(ctx, req)
+	out := make(chan facade.StreamEvent, 4)
+	if !c.fail {
+		for _, d := range c.deltas(req) {
+			out <- facade.StreamEvent{Source: c.source, Delta: d}
+		}
+	}
+	out <- facade.StreamEvent{Source: c.source, Done: true, FinishReason: resp.FinishReason, Error: resp.Error, Response: &resp}
+	close(out)
+	return out, nil
+}
+
+func (c *stubClient) deltas(req facade.Request) []string {
+	return []string{c.source, ":", req.Options.ModelFor(c.source, c.model)}
+}
+
+func init() {
+	gin.SetMode(gin.TestMode)
+	for _, stub := range []*stubClient{
+		{source: "Alpha", model: "alpha-default"},
+		{source: "Beta", model: "beta-default"},
+		{source: "Broken", fail: true},
+	} {
+		stub := stub
+		facade.Register(stub.source, func(*facade.Config) (facade.AIClient, error) { return stub, nil })
+	}
+}
+
+// newOpenAIRouter serves the OpenAI-compatible routes over the stub
+// providers, without authentication or budgets, recording usage in a
+// fresh store
+func newOpenAIRouter(t *testing.T) (*gin.Engine, storage.ResultStore) {
+	t.Helper()
+	cfg := &facade.Config{Providers: []string{"alpha", "beta", "broken"}, MaxBodyBytes: 1 << 20}
+	f, err := facade.NewFacade(cfg)
+	if err != nil {
+		t.Fatalf("NewFacade: %v", err)
+	}
+	store, err := storage.NewSQLStore(storage.DriverSQLite, "file:"+t.TempDir()+"/api.db")
+	if err != nil {
+		t.Fatalf("NewSQLStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	s := &server{cfg: cfg, f: f, store: store, budget: budget.New(nil, cfg)}
+	r := gin.New()
+	r.Use(s.authenticate)
+	r.POST("/v1/chat/completions", s.chatCompletions)
+	r.GET("/v1/models", s.listModels)
+	return r, store
+}
+
+// postCompletion sends a chat completion request for model
+func postCompletion(r http.Handler, model string, stream bool) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(gin.H{"model": model, "stream": stream, "messages": []gin.H{{"role": "user", "content": "hi"}}})
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(string(body)))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// sseChunks decodes the data lines of an SSE body, which must end with [DONE]
+func sseChunks(t *testing.T, body string) []chatCompletion {
+	t.Helper()
+	var chunks []chatCompletion
+	done := false
+	for _, frame := range strings.Split(strings.TrimSpace(body), "\n\n") {
+		data, ok := strings.CutPrefix(frame, "data: ")
+		if !ok || done {
+			t.Fatalf("unexpected frame %q", frame)
+		}
+		if data == "[DONE]" {
+			done = true
+			continue
+		}
+		var chunk chatCompletion
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("chunk %q: %v", data, err)
+		}
+		if chunk.Object != "chat.completion.chunk" || len(chunk.Choices) != 1 {
+			t.Fatalf("chunk = %+v", chunk)
+		}
+		chunks = append(chunks, chunk)
+	}
+	if !done {
+		t.Fatal("stream did not end with [DONE]")
+	}
+	return chunks
+}
+
+func TestChatCompletions(t *testing.T) {
+	r, _ := newOpenAIRouter(t)
+	for _, tc := range []struct {
+		model   string
+		status  int
+		answers []string // Sorted choice contents; nil to skip
+	}{
+		{model: "alpha", status: http.StatusOK, answers: []string{"Alpha:alpha-default"}},
+		{model: "alpha/alpha-large", status: http.StatusOK, answers: []string{"Alpha:alpha-large"}},
+		{model: "Beta", status: http.StatusOK, answers: []string{"Beta:beta-default"}},
+		{model: "merged/all", status: http.StatusOK, answers: []string{"Alpha:alpha-default", "Beta:beta-default"}},
+		{model: "merged/first-successful", status: http.StatusOK},
+		{model: "gamma", status: http.StatusNotFound},
+		{model: "gamma/large", status: http.StatusNotFound},
+		{model: "merged/bogus", status: http.StatusBadRequest},
+		{model: "broken", status: http.StatusBadGateway},
+	} {
+		t.Run(tc.model, func(t *testing.T) {
+			w := postCompletion(r, tc.model, false)
+			if w.Code != tc.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tc.status, w.Body)
+			}
+			if tc.status != http.StatusOK {
+				var resp struct {
+					Error struct{ Message, Type string }
+				}
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Error.Message == "" {
+					t.Fatalf("error body = %s", w.Body)
+				}
+				return
+			}
+
+			var completion chatCompletion
+			if err := json.Unmarshal(w.Body.Bytes(), &completion); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if completion.Object != "chat.completion" || completion.Model != tc.model || !strings.HasPrefix(completion.ID, "chatcmpl-") {
+				t.Errorf("completion = %+v", completion)
+			}
+			var got []string
+			for i, choice := range completion.Choices {
+				if choice.Index != i || choice.Message == nil || choice.Message.Role != facade.RoleAssistant ||
+					choice.FinishReason == nil || *choice.FinishReason != "stop" {
+					t.Fatalf("choice %d = %+v", i, choice)
+				}
+				got = append(got, choice.Message.Content)
+			}
+			sort.Strings(got)
+			if tc.answers == nil {
+				if len(got) != 1 || (got[0] != "Alpha:alpha-default" && got[0] != "Beta:beta-default") {
+					t.Errorf("choices = %q, want one provider's answer", got)
+				}
+			} else if strings.Join(got, "|") != strings.Join(tc.answers, "|") {
+				t.Errorf("choices = %q, want %q", got, tc.answers)
+			} else if u := completion.Usage; u == nil || u.PromptTokens != 3*len(got) || u.TotalTokens != 5*len(got) {
+				t.Errorf("usage = %+v, want the sum over %d calls", u, len(got))
+			}
+		})
+	}
+}
+
+func TestChatCompletionsStream(t *testing.T) {
+	r, _ := newOpenAIRouter(t)
+
+	w := postCompletion(r, "alpha/alpha-large", true)
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		t.Fatalf("status = %d, Content-Type = %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	chunks := sseChunks(t, w.Body.String())
+	if len(chunks) != 5 {
+		t.Fatalf("got %d chunks, want a role chunk, 3 deltas and a finish chunk: %s", len(chunks), w.Body)
+	}
+	if first := chunks[0].Choices[0]; first.Delta == nil || first.Delta.Role != facade.RoleAssistant || first.FinishReason != nil {
+		t.Errorf("first chunk = %+v", first)
+	}
+	var content strings.Builder
+	for _, chunk := range chunks[1:4] {
+		if chunk.ID != chunks[0].ID || chunk.Model != "alpha/alpha-large" {
+			t.Errorf("chunk = %+v", chunk)
+		}
+		content.WriteString(chunk.Choices[0].Delta.Content)
+	}
+	if content.String() != "Alpha:alpha-large" {
+		t.Errorf("content = %q", content.String())
+	}
+	if last := chunks[4].Choices[0]; last.FinishReason == nil || *last.FinishReason != "stop" {
+		t.Errorf("last chunk = %+v", last)
+	}
+}
+
+func TestChatCompletionsStreamMerged(t *testing.T) {
+	r, _ := newOpenAIRouter(t)
+
+	w := postCompletion(r, "merged/all", true)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var got []string
+	for _, chunk := range sseChunks(t, w.Body.String()) {
+		choice := chunk.Choices[0]
+		if choice.Delta == nil || choice.Message != nil || choice.FinishReason == nil {
+			t.Fatalf("chunk = %+v", chunk)
+		}
+		got = append(got, choice.Delta.Content)
+	}
+	sort.Strings(got)
+	if strings.Join(got, "|") != "Alpha:alpha-default|Beta:beta-default" {
+		t.Errorf("chunks = %q, want one per successful provider", got)
+	}
+}
+
+func TestChatCompletionsRecordUsage(t *testing.T) {
+	r, store := newOpenAIRouter(t)
+	if w := postCompletion(r, "merged/all", false); w.Code != http.StatusOK {
+		t.Fatalf("merged/all: status = %d: %s", w.Code, w.Body)
+	}
+	if w := postCompletion(r, "alpha", true); w.Code != http.StatusOK {
+		t.Fatalf("stream: status = %d: %s", w.Code, w.Body)
+	}
+
+	today := time.Now().UTC()
+	records, err := store.GetUsage(storage.AnonymousTenant, today.AddDate(0, 0, -1), today.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("GetUsage: %v", err)
+	}
+	total := storage.SumUsage(records)
+	if total.Requests != 3 || total.InputTokens != 9 || total.OutputTokens != 6 {
+		t.Errorf("usage = %+v, want 3 calls: Alpha and Beta, then Alpha streamed", total)
+	}
+}
+
+func TestListModels(t *testing.T) {
+	r, _ := newOpenAIRouter(t)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/models", nil))
+
+	var list struct {
+		Data []struct{ ID string }
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	var ids []string
+	for _, m := range list.Data {
+		ids = append(ids, m.ID)
+	}
+	want := "alpha beta broken merged/all merged/first-successful merged/fastest-n merged/consensus"
+	if strings.Join(ids, " ") != want {
+		t.Errorf("models = %v, want %s (no judge configured)", ids, want)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/budget"
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/facade"
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/queue"
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/ratelimit"
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/storage"
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/worker"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// server holds what the handlers share
+type server struct {
+	cfg     *facade.Config
+	f       *facade.Facade // Answers /v1/chat/completions; nil without usable providers
+	broker  queue.Broker
+	store   storage.ResultStore
+	events  *storage.RedisClient // Live progress for /results/:taskID/stream
+	limiter *ratelimit.Limiter
+	budget  *budget.Guard
+}
+
+// taskRequest is the JSON body of POST /v1/tasks
+type taskRequest struct {
+	Messages  []facade.ChatMessage     `json:"messages"`
+	Options   facade.GenerationOptions `json:"options"`
+	Providers []string                 `json:"providers"`
+	Strategy  string                   `json:"strategy"`
+	N         int                      `json:"n"`
+	Stream    bool                     `json:"stream"`
+	Callback  string                   `json:"callback"` // URL the finished task is POSTed to
+}
+
+// enqueue records msg under a new task ID, charges it to the tenant's
+// quota and publishes it. With an idempotency key, a request already seen
+// under that key from the same tenant is not queued or charged again; its
+// task ID is returned with replayed set.
+func (s *server) enqueue(msg queue.Message, key string) (taskID string, replayed bool, err error) {
+	msg.TaskID = uuid.New().String()
+	if key != "" {
+		// Tenants cannot see, or collide with, each other's keys
+		key = msg.Tenant + ":" + key
+		existing, err := s.store.ReserveIdempotencyKey(key, msg.Fingerprint(), msg.TaskID, s.cfg.IdempotencyWindow)
+		if err != nil {
+			return "", false, err
+		}
+		if existing != "" {
+			return existing, true, nil
+		}
+	}
+
+	if err := s.useQuota(msg.Tenant); err != nil {
+		s.releaseKey(key)
+		return "", false, err
+	}
+	if err := s.store.CreateTask(msg.TaskID, msg.Tenant, msg.Request()); err != nil {
+		s.releaseKey(key)
+		s.refundQuota(msg.Tenant)
+		return "", false, fmt.Errorf("Failed to record task: %v", err)
+	}
+	if err := s.broker.Publish(msg); err != nil {
+		if err := s.store.FailTask(msg.TaskID, fmt.Sprintf("enqueue failed: %v", err)); err != nil {
+			log.Printf("Failed to mark task %s failed: %v", msg.TaskID, err)
+		}
+		// Let the caller retry with the same key
+		s.releaseKey(key)
+		s.refundQuota(msg.Tenant)
+		return "", false, fmt.Errorf("Failed to enqueue request: %w", err)
+	}
+	return msg.TaskID, false, nil
+}
+
+// releaseKey forgets an idempotency key whose task was never queued
+func (s *server) releaseKey(key string) {
+	if key == "" {
+		return
+	}
+	if err := s.store.ReleaseIdempotencyKey(key); err != nil {
+		log.Printf("Failed to release idempotency key %q: %v", key, err)
+	}
+}
+
+// enqueueFailed answers an enqueue error with its HTTP status
+func enqueueFailed(c *gin.Context, err error) {
+	var qerr *quotaError
+	if errors.As(err, &qerr) {
+		quotaFailed(c, err)
+		return
+	}
+	c.JSON(enqueueStatus(err), gin.H{"error": err.Error()})
+}
+
+// enqueueStatus maps an enqueue error to its HTTP status
+func enqueueStatus(err error) int {
+	switch {
+	case errors.Is(err, storage.ErrIdempotencyConflict):
+		return http.StatusConflict
+	case errors.Is(err, queue.ErrUnconfirmed), errors.Is(err, queue.ErrNotConnected):
+		// The broker may not have the message; the caller should retry
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// createTask handles POST /v1/tasks: it validates the JSON body, queues
+// the task and answers 202 with the task and its Location, or 200 with
+// the original task when the Idempotency-Key was already used for it
+func (s *server) createTask(c *gin.Context) {
+	var body taskRequest
+	dec := json.NewDecoder(http.MaxBytesReader(c.Writer, c.Request.Body, s.cfg.MaxBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&body); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Request body exceeds %d bytes", tooLarge.Limit)})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid JSON body: %v", err)})
+		return
+	}
+
+	msg := queue.Message{
+		Messages:  body.Messages,
+		Options:   body.Options,
+		Merge:     facade.MergeOptions{Strategy: strings.ToLower(body.Strategy), N: body.N},
+		Providers: body.Providers,
+		Stream:    body.Stream,
+		Callback:  body.Callback,
+		Tenant:    tenant(c),
+	}
+	if errs := s.validate(msg); len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "validation failed", "fields": errs})
+		return
+	}
+
+	taskID, replayed, err := s.enqueue(msg, c.GetHeader("Idempotency-Key"))
+	if err != nil {
+		enqueueFailed(c, err)
+		return
+	}
+	task, err := s.store.GetTask(taskID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to fetch task: %v", err)})
+		return
+	}
+	if task == nil {
+		// The original request under this key is still being recorded
+		task = &storage.Task{ID: taskID, Status: storage.StatusQueued}
+	}
+	c.Header("Location", "/v1/tasks/"+taskID)
+	if replayed {
+		c.JSON(http.StatusOK, task)
+		return
+	}
+	c.JSON(http.StatusAccepted, task)
+}
+
+// getTask handles GET /v1/tasks/:id
+func (s *server) getTask(c *gin.Context) {
+	if task := s.ownedTask(c, c.Param("id")); task != nil {
+		c.JSON(http.StatusOK, task)
+	}
+}
+
+// validate checks msg's request and the fields only the API can check:
+// that the providers are enabled and the callback is a public http(s) URL
+func (s *server) validate(msg queue.Message) facade.ValidationError {
+	var errs facade.ValidationError
+	if err := msg.Request().Validate(); !errors.As(err, &errs) && err != nil {
+		errs = facade.ValidationError{{Field: "request", Message: err.Error()}}
+	}
+	for i, name := range msg.Providers {
+		if name != "" && !s.providerEnabled(name) {
+			errs = append(errs, facade.FieldError{Field: fmt.Sprintf("providers[%d]", i), Message: fmt.Sprintf("provider %q is not enabled", name)})
+		}
+	}
+	if msg.Callback != "" {
+		if err := worker.CheckCallback(msg.Callback); err != nil {
+			errs = append(errs, facade.FieldError{Field: "callback", Message: err.Error()})
+		}
+	}
+	return errs
+}
+
+// providerEnabled reports whether name is one of the configured providers
+func (s *server) providerEnabled(name string) bool {
+	for _, p := range s.cfg.Providers {
+		if strings.EqualFold(p, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/facade"
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// getUsage handles GET /v1/usage: the caller's tokens and cost per day,
+// provider and model between the from and to query days, plus the total
+func (s *server) getUsage(c *gin.Context) {
+	from, to, err := storage.ParseUsageRange(c.Query("from"), c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	records, err := s.store.GetUsage(tenant(c), from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to fetch usage: %v", err)})
+		return
+	}
+	if records == nil {
+		records = []storage.UsageRecord{}
+	}
+	total := storage.SumUsage(records)
+	c.JSON(http.StatusOK, gin.H{
+		"tenant": tenant(c),
+		"from":   from.Format(time.DateOnly),
+		"to":     to.Format(time.DateOnly),
+		"total":  gin.H{"requests": total.Requests, "input_tokens": total.InputTokens, "output_tokens": total.OutputTokens, "cost": total.Cost},
+		"usage":  records,
+	})
+}
+
+// recordUsage adds the calls behind a synchronous completion to the
+// caller's usage and spend. Failures are only logged; the answer is
+// already paid for.
+func (s *server) recordUsage(c *gin.Context, result facade.MergedApiResponse) {
+	if err := s.store.RecordUsage(tenant(c), result); err != nil {
+		log.Printf("Failed to record usage: %v", err)
+	}
+	s.budget.Record(tenant(c), result.TotalUsage().Cost)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/facade"
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/queue"
+)
+
+// runDLQ implements "cli dlq list" and "cli dlq replay"
+func runDLQ(args []string) {
+	fs := flag.NewFlagSet("dlq", flag.ExitOnError)
+	limit := fs.Int("n", 0, "Maximum number of messages (0 for all)")
+	taskID := fs.String("task", "", "Only replay the message for this task ID")
+	showBody := fs.Bool("body", false, "Print message bodies when listing")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: cli dlq list [-n N] [-body]")
+		fmt.Fprintln(os.Stderr, "       cli dlq replay [-n N] [-task ID]")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	cmd := args[0]
+	fs.Parse(args[1:])
+
+	cfg, err := facade.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	broker, err := queue.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize queue: %v", err)
+	}
+	defer broker.Close()
+	dlq, ok := broker.(queue.DeadLetters)
+	if !ok || cfg.QueueBackend == queue.BackendMemory {
+		// The in-process dead letters live in the api_server, not here
+		log.Fatalf("The %s queue backend has no dead-letter queue to inspect from the CLI", cfg.QueueBackend)
+	}
+
+	switch cmd {
+	case "list":
+		letters, err := dlq.InspectDeadLetters(*limit)
+		if err != nil {
+			log.Fatalf("Failed to inspect dead-letter queue: %v", err)
+		}
+		if len(letters) == 0 {
+			fmt.Println("Dead-letter queue is empty")
+			return
+		}
+		for _, dl := range letters {
+			id := dl.TaskID
+			if id == "" {
+				id = "(unparseable)"
+			}
+			failedAt := "-"
+			if !dl.FailedAt.IsZero() {
+				failedAt = dl.FailedAt.Local().Format(time.DateTime)
+			}
+			fmt.Printf("%s  deliveries=%d  failed=%s  reason=%s\n", id, dl.Deliveries, failedAt, dl.Reason)
+			if *showBody {
+				fmt.Printf("  %s\n", dl.Body)
+			}
+		}
+	case "replay":
+		n, err := dlq.ReplayDeadLetters(*limit, *taskID)
+		if err != nil {
+			log.Fatalf("Failed to replay dead-letter queue after %d messages: %v", n, err)
+		}
+		fmt.Printf("Replayed %d message(s)\n", n)
+	default:
+		fs.Usage()
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/facade"
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/storage"
+)
+
+// runKeys implements "cli keys create", "cli keys list" and "cli keys revoke"
+func runKeys(args []string) {
+	fs := flag.NewFlagSet("keys", flag.ExitOnError)
+	tenant := fs.String("tenant", "", "Tenant the key belongs to (create), or to list keys of")
+	name := fs.String("name", "", "Optional label for the key")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: cli keys create -tenant TENANT [-name NAME]")
+		fmt.Fprintln(os.Stderr, "       cli keys list [-tenant TENANT]")
+		fmt.Fprintln(os.Stderr, "       cli keys revoke ID")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	cmd := args[0]
+	fs.Parse(args[1:])
+
+	cfg, err := facade.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	store, err := storage.NewResultStore(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize result store: %v", err)
+	}
+	defer store.Close()
+
+	switch cmd {
+	case "create":
+		if *tenant == "" {
+			fs.Usage()
+			os.Exit(1)
+		}
+		if *tenant == storage.AnonymousTenant {
+			log.Fatalf("Tenant %q is reserved for unauthenticated callers", storage.AnonymousTenant)
+		}
+		key, record, err := storage.NewAPIKey(*tenant, *name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := store.CreateAPIKey(record); err != nil {
+			log.Fatalf("Failed to store API key: %v", err)
+		}
+		fmt.Printf("Created key %s for tenant %s. It is shown only once:\n%s\n", record.ID, record.Tenant, key)
+	case "list":
+		keys, err := store.ListAPIKeys(*tenant)
+		if err != nil {
+			log.Fatalf("Failed to list API keys: %v", err)
+		}
+		if len(keys) == 0 {
+			fmt.Println("No API keys")
+			return
+		}
+		for _, k := range keys {
+			status := "active"
+			if k.Revoked() {
+				status = "revoked " + k.RevokedAt.Local().Format(time.DateTime)
+			}
+			fmt.Printf("%s  %s…  tenant=%s  name=%s  created=%s  %s\n",
+				k.ID, k.Prefix, k.Tenant, k.Name, k.CreatedAt.Local().Format(time.DateTime), status)
+		}
+	case "revoke":
+		if fs.NArg() != 1 {
+			fs.Usage()
+			os.Exit(1)
+		}
+		err := store.RevokeAPIKey(fs.Arg(0))
+		if errors.Is(err, storage.ErrKeyNotFound) {
+			fmt.Printf("No API key with ID %s\n", fs.Arg(0))
+			os.Exit(1)
+		}
+		if err != nil {
+			log.Fatalf("Failed to revoke API key: %v", err)
+		}
+		fmt.Printf("Revoked key %s\n", fs.Arg(0))
+	default:
+		fs.Usage()
+		os.Exit(1)
+	}
+}
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
 
 	"github.com/Rammurthy5/ai_agents_wrapper/internal/facade"
 	"github.com/Rammurthy5/ai_agents_wrapper/internal/queue"
@@ -15,10 +20,32 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "dlq":
+			runDLQ(os.Args[2:])
+			return
+		case "keys":
+			runKeys(os.Args[2:])
+			return
+		case "usage":
+			runUsage(os.Args[2:])
+			return
+		}
+	}
+
 	prompt := flag.String("prompt", "", "The prompt to process")
+	system := flag.String("system", "", "Optional system prompt")
+	messagesFile := flag.String("messages", "", "JSON file holding a [{\"role\",\"content\"}] conversation ('-' for stdin)")
 	queueMode := flag.Bool("queue", false, "Send prompt to RabbitMQ instead of processing directly")
 	taskID := flag.String("task", "", "Fetch result for a given task ID")
 	verbose := flag.Bool("v", false, "Enable verbose output")
+	stream := flag.Bool("stream", false, "Print tokens as providers generate them (direct mode only)")
+	strategy := flag.String("strategy", facade.StrategyAll, "Merge strategy: all, first-successful, fastest-n, consensus or judge")
+	n := flag.Int("n", 0, "Number of results for the fastest-n strategy")
+	idempotencyKey := flag.String("idempotency-key", "", "With -queue, reuse the task already queued under this key instead of queueing again")
+	var opts facade.GenerationOptions
+	registerGenerationFlags(&opts)
 	flag.Parse()
 
 	if !*verbose {
@@ -32,60 +59,198 @@ func main() {
 
 	if *taskID != "" {
 		// Fetch result mode
-		redisClient, err := storage.NewRedisClient(cfg.Redis_URL)
+		store, err := storage.NewResultStore(cfg)
 		if err != nil {
-			log.Fatalf("Failed to initialize Redis: %v", err)
+			log.Fatalf("Failed to initialize result store: %v", err)
 		}
-		defer redisClient.Close()
+		defer store.Close()
 
-		result, err := redisClient.GetResult(*taskID)
+		task, err := store.GetTask(*taskID)
 		if err != nil {
 			log.Fatalf("Failed to fetch result: %v", err)
 		}
-		if result == nil {
-			fmt.Printf("No result found for task %s\n", *taskID)
+		if task == nil {
+			fmt.Printf("No task found with ID %s\n", *taskID)
 			os.Exit(1)
 		}
 
-		for _, r := range result.Results {
-			if r.Error != nil {
-				fmt.Printf("%s failed: %v\n", r.Source, r.Error)
-			} else {
-				fmt.Printf("%s: %s\n", r.Source, r.Message)
-			}
+		fmt.Printf("Task %s: %s\n", task.ID, task.Status)
+		if task.Error != "" {
+			fmt.Printf("Error: %s\n", task.Error)
+		}
+		switch {
+		case task.Result != nil:
+			printResult(*task.Result)
+		case len(task.Partial) > 0:
+			printResult(facade.MergedApiResponse{Results: task.Partial})
 		}
 		return
 	}
 
-	if *prompt == "" {
-		fmt.Println("Error: -prompt is required unless -task is provided")
+	if *prompt == "" && *messagesFile == "" {
+		fmt.Println("Error: -prompt or -messages is required unless -task is provided")
 		flag.Usage()
 		os.Exit(1)
 	}
-
-	f := facade.NewFacade(cfg)
+	req := facade.Request{
+		Messages: facade.PromptMessages(*system, *prompt),
+		Options:  opts,
+		Merge:    facade.MergeOptions{Strategy: strings.ToLower(*strategy), N: *n},
+	}
+	if *messagesFile != "" {
+		msgs, err := readMessages(*messagesFile)
+		if err != nil {
+			log.Fatalf("Failed to read messages: %v", err)
+		}
+		req.Messages = msgs
+	}
+	if err := req.Validate(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
 
 	if *queueMode {
-		rabbit, err := queue.NewRabbitMQ(cfg.RABBITMQ_URL)
+		if cfg.QueueBackend == queue.BackendMemory {
+			log.Fatalf("-queue needs a shared queue backend; QUEUE_BACKEND is %q", cfg.QueueBackend)
+		}
+		broker, err := queue.New(cfg)
 		if err != nil {
-			log.Fatalf("Failed to initialize RabbitMQ: %v", err)
+			log.Fatalf("Failed to initialize queue: %v", err)
 		}
-		defer rabbit.Close()
+		defer broker.Close()
 
 		taskID := uuid.New().String()
-		msg := queue.Message{TaskID: taskID, Prompt: *prompt}
-		if err := rabbit.Publish(msg); err != nil {
+		msg := queue.Message{TaskID: taskID, Messages: req.Messages, Options: req.Options, Merge: req.Merge}
+		var store storage.ResultStore
+		if *idempotencyKey != "" {
+			if store, err = storage.NewResultStore(cfg); err != nil {
+				log.Fatalf("Failed to initialize result store: %v", err)
+			}
+			defer store.Close()
+			existing, err := store.ReserveIdempotencyKey(*idempotencyKey, msg.Fingerprint(), taskID, cfg.IdempotencyWindow)
+			if err != nil {
+				log.Fatalf("Failed to reserve idempotency key: %v", err)
+			}
+			if existing != "" {
+				fmt.Printf("Conversation already queued with task ID: %s\n", existing)
+				return
+			}
+		}
+		if err := broker.Publish(msg); err != nil {
+			if store != nil {
+				if err := store.ReleaseIdempotencyKey(*idempotencyKey); err != nil {
+					log.Printf("Failed to release idempotency key: %v", err)
+				}
+			}
 			log.Fatalf("Failed to enqueue prompt: %v", err)
 		}
-		fmt.Printf("Prompt '%s' queued with task ID: %s\n", *prompt, taskID)
+		fmt.Printf("Conversation queued with task ID: %s\n", taskID)
 	} else {
-		result := f.GetMergedResults(*prompt)
-		for _, r := range result.Results {
-			if r.Error != nil {
-				fmt.Printf("%s failed: %v\n", r.Source, r.Error)
-			} else {
-				fmt.Printf("%s: %s\n", r.Source, r.Message)
-			}
+		f, err := facade.NewFacade(cfg)
+		if err != nil {
+			log.Fatalf("Failed to initialize facade: %v", err)
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		if *stream {
+			printStream(f.Stream(ctx, req))
+			return
+		}
+		result := f.GetMergedResults(ctx, req)
+		printResult(result)
+	}
+}
+
+// printStream prints deltas as they arrive, labelling each run of output
+// with its provider
+func printStream(events <-chan facade.StreamEvent) {
+	last := ""
+	for ev := range events {
+		if ev.Source != last && (ev.Delta != "" || ev.Error != "") {
+			fmt.Printf("\n[%s] ", ev.Source)
+			last = ev.Source
 		}
+		switch {
+		case ev.Delta != "":
+			fmt.Print(ev.Delta)
+		case ev.Done && ev.Error != "":
+			fmt.Printf("failed: %v", ev.Error)
+		}
+	}
+	fmt.Println()
+}
+
+// printResult prints each provider's answer, then the merged output if the
+// strategy produced one
+func printResult(result facade.MergedApiResponse) {
+	for _, r := range result.Results {
+		if r.Error != "" {
+			fmt.Printf("%s failed: %v\n", r.Source, r.Error)
+		} else {
+			fmt.Printf("%s: %s\n", r.Source, r.Message)
+		}
+	}
+	if result.Strategy != "" && result.Strategy != facade.StrategyAll {
+		fmt.Printf("\n[%s] %s\n", result.Strategy, result.Rationale)
+		if result.Output != "" {
+			fmt.Printf("Output: %s\n", result.Output)
+		}
+	}
+	if u := result.Usage; u.InputTokens > 0 || u.OutputTokens > 0 {
+		fmt.Printf("\nUsage: %d input + %d output tokens, $%.6f\n", u.InputTokens, u.OutputTokens, u.Cost)
 	}
 }
+
+// readMessages loads a JSON conversation from path, or stdin for "-"
+func readMessages(path string) ([]facade.ChatMessage, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var msgs []facade.ChatMessage
+	if err := json.Unmarshal(data, &msgs); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	return msgs, nil
+}
+
+// registerGenerationFlags binds the generation parameter flags to opts
+func registerGenerationFlags(opts *facade.GenerationOptions) {
+	flag.Func("model", "Model for one provider as provider=model (repeatable)", func(v string) error {
+		provider, model, ok := strings.Cut(v, "=")
+		if !ok || provider == "" || model == "" {
+			return fmt.Errorf("want provider=model, got %q", v)
+		}
+		if opts.Models == nil {
+			opts.Models = make(map[string]string)
+		}
+		opts.Models[strings.ToLower(provider)] = model
+		return nil
+	})
+	flag.Func("temperature", "Sampling temperature (0-2)", func(v string) error {
+		t, err := strconv.ParseFloat(v, 64)
+		opts.Temperature = &t
+		return err
+	})
+	flag.Func("top-p", "Nucleus sampling probability (0-1)", func(v string) error {
+		p, err := strconv.ParseFloat(v, 64)
+		opts.TopP = &p
+		return err
+	})
+	flag.IntVar(&opts.MaxTokens, "max-tokens", 0, "Maximum tokens to generate (0 for provider default)")
+	flag.Func("stop", "Stop sequence (repeatable)", func(v string) error {
+		opts.Stop = append(opts.Stop, v)
+		return nil
+	})
+	flag.Func("seed", "Sampling seed, where supported", func(v string) error {
+		seed, err := strconv.ParseInt(v, 10, 64)
+		opts.Seed = &seed
+		return err
+	})
+}
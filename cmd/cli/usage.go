@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/facade"
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/storage"
+)
+
+// runUsage implements "cli usage": token usage and cost per day, tenant,
+// provider and model, read from the result store
+func runUsage(args []string) {
+	fs := flag.NewFlagSet("usage", flag.ExitOnError)
+	tenant := fs.String("tenant", "", "Only show this tenant's usage")
+	from := fs.String("from", "", "First day to report, YYYY-MM-DD (default: start of this month)")
+	to := fs.String("to", "", "Last day to report, YYYY-MM-DD (default: today)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: cli usage [-tenant TENANT] [-from YYYY-MM-DD] [-to YYYY-MM-DD]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	start, end, err := storage.ParseUsageRange(*from, *to)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg, err := facade.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	store, err := storage.NewResultStore(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize result store: %v", err)
+	}
+	defer store.Close()
+
+	records, err := store.GetUsage(*tenant, start, end)
+	if err != nil {
+		log.Fatalf("Failed to fetch usage: %v", err)
+	}
+	if len(records) == 0 {
+		fmt.Println("No usage")
+		return
+	}
+	for _, u := range records {
+		fmt.Printf("%s  tenant=%s  %s/%s  requests=%d  input=%d  output=%d  cost=$%.6f\n",
+			u.Day, u.Tenant, u.Source, u.Model, u.Requests, u.InputTokens, u.OutputTokens, u.Cost)
+	}
+	total := storage.SumUsage(records)
+	fmt.Printf("Total  requests=%d  input=%d  output=%d  cost=$%.6f\n", total.Requests, total.InputTokens, total.OutputTokens, total.Cost)
+}
@@ -1,16 +1,19 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
 
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/budget"
 	"github.com/Rammurthy5/ai_agents_wrapper/internal/facade"
 	"github.com/Rammurthy5/ai_agents_wrapper/internal/queue"
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/ratelimit"
 	"github.com/Rammurthy5/ai_agents_wrapper/internal/storage"
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/worker"
 )
 
 func main() {
@@ -19,56 +22,61 @@ func main() {
 	if err != nil {
 		log.Fatal("Failed to load config:", err)
 	}
+	if err := cfg.RequireBackends(); err != nil {
+		log.Fatal("Failed to load config:", err)
+	}
+	if cfg.QueueBackend == queue.BackendMemory {
+		log.Fatal("The memory queue backend runs its worker inside api_server")
+	}
 
 	// initialize facade
-	f := facade.NewFacade(cfg)
+	f, err := facade.NewFacade(cfg)
+	if err != nil {
+		log.Fatal("Failed to initialize facade:", err)
+	}
 
-	// initialize RabbitMQ
-	rabbit, err := queue.NewRabbitMQ(cfg.RABBITMQ_URL)
+	// Provider limits and spend budgets are shared by every worker through Redis
+	limiter, err := ratelimit.New(cfg.Redis_URL)
 	if err != nil {
-		log.Fatal("Failed to initialize RabbitMQ:", err)
+		log.Fatal("Failed to initialize rate limiter:", err)
 	}
-	defer rabbit.Close()
+	defer limiter.Close()
+	f.SetLimiter(limiter.Providers(cfg.ProviderLimits))
 
-	redisClient, err := storage.NewRedisClient(cfg.Redis_URL)
+	// initialize the queue
+	broker, err := queue.New(cfg)
 	if err != nil {
-		log.Fatal("Failed to initialize Redis:", err)
+		log.Fatal("Failed to initialize queue:", err)
 	}
-	defer redisClient.Close()
+	defer broker.Close()
 
-	// start consuming messages
-	msgs, err := rabbit.Consume()
+	store, err := storage.NewResultStore(cfg)
 	if err != nil {
-		log.Fatal("Failed to consume from queue:", err)
+		log.Fatal("Failed to initialize result store:", err)
 	}
+	defer store.Close()
+
+	// Redis carries live progress events whichever store holds results
+	redisClient, err := storage.NewRedisClient(cfg.Redis_URL, cfg.TaskTTL)
+	if err != nil {
+		log.Fatal("Failed to initialize Redis:", err)
+	}
+	defer redisClient.Close()
+
+	hostname, _ := os.Hostname()
+	w := worker.New(fmt.Sprintf("%s-%d", hostname, os.Getpid()), f, broker, store, redisClient, budget.New(limiter, cfg), cfg)
 
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	// Cancelled on Ctrl+C / SIGTERM, which stops consuming
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		// A second signal kills the process outright
+		stop()
+	}()
 
-	fmt.Println("Worker started. Consuming from queue. Press Ctrl+C to stop..")
-	for {
-		select {
-		case msg := <-msgs:
-			var task queue.Message
-			fmt.Printf("Received message %v\n", msg.Body)
-			if err := json.Unmarshal(msg.Body, &task); err != nil {
-				log.Printf("Failed to unmarshal message: %v", err)
-				fmt.Printf("Failed to unmarshal message: %v", err)
-				continue
-			}
-			fmt.Printf("json unmarshalled task %v\n", task.Prompt)
-			// process the prompt
-			result := f.GetMergedResults(task.Prompt)
-			fmt.Printf("Result: %v\n", result)
-			if err := redisClient.StoreResult(task.TaskID, result); err != nil {
-				log.Printf("Failed to store result for task %s: %v", task.TaskID, err)
-				fmt.Printf("Failed to store result for task %s: %v", task.TaskID, err)
-				continue
-			}
-			fmt.Printf("Stored result for task %s\n", task.TaskID)
-		case <-sigChan:
-			fmt.Println("Worker shutting down")
-			return
-		}
+	fmt.Println("Press Ctrl+C to stop..")
+	if err := w.Run(ctx); err != nil {
+		log.Fatal(err)
 	}
 }
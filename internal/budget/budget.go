@@ -0,0 +1,163 @@
+package budget
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/facade"
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/ratelimit"
+)
+
+// Budget scopes reported in alerts
+const (
+	ScopeTenant = "tenant"
+	ScopeGlobal = "global"
+)
+
+// webhookTimeout bounds one alert POST
+const webhookTimeout = 10 * time.Second
+
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+// Guard checks spend budgets before a request fans out to the providers,
+// and raises alerts as recorded spend crosses the alert thresholds.
+// Budgets are soft: requests already in flight may overshoot them.
+type Guard struct {
+	limiter *ratelimit.Limiter
+	cfg     *facade.Config
+}
+
+// New returns a Guard keeping spend in the limiter's Redis
+func New(limiter *ratelimit.Limiter, cfg *facade.Config) *Guard {
+	return &Guard{limiter: limiter, cfg: cfg}
+}
+
+// Alert is logged, and POSTed to BUDGET_ALERT_WEBHOOK if set, when spend
+// crosses a threshold
+type Alert struct {
+	Scope     string    `json:"scope"`
+	Tenant    string    `json:"tenant,omitempty"`
+	Period    string    `json:"period"`
+	Threshold int       `json:"threshold"` // Percent of the budget
+	Spent     float64   `json:"spent"`
+	Budget    float64   `json:"budget"`
+	Action    string    `json:"action,omitempty"` // Applied from now on; set at 100% and above
+	Time      time.Time `json:"time"`
+}
+
+// limit is one budget and the spend counted against it
+type limit struct {
+	scope, tenant, period string
+	spent, budget         float64
+}
+
+func (l limit) String() string {
+	if l.scope == ScopeTenant {
+		return fmt.Sprintf("the %s budget of $%.2f for tenant %q is used up", l.period, l.budget, l.tenant)
+	}
+	return fmt.Sprintf("the global %s budget of $%.2f is used up", l.period, l.budget)
+}
+
+// limits pairs tenant's and the global budgets with spend
+func (g *Guard) limits(tenant string, s ratelimit.Spend) []limit {
+	b := g.cfg.BudgetFor(tenant)
+	return []limit{
+		{ScopeTenant, tenant, ratelimit.PeriodDay, s.TenantDay, b.Daily},
+		{ScopeTenant, tenant, ratelimit.PeriodMonth, s.TenantMonth, b.Monthly},
+		{ScopeGlobal, "", ratelimit.PeriodDay, s.GlobalDay, g.cfg.GlobalBudget.Daily},
+		{ScopeGlobal, "", ratelimit.PeriodMonth, s.GlobalMonth, g.cfg.GlobalBudget.Monthly},
+	}
+}
+
+// Check returns req as it may fan out for tenant: unchanged while every
+// budget has room, otherwise restricted by f as BUDGET_ACTION says.
+// Refused requests get an error wrapping facade.ErrOverBudget.
+func (g *Guard) Check(f *facade.Facade, tenant string, req facade.Request) (facade.Request, error) {
+	if g.cfg.BudgetFor(tenant) == (facade.Budget{}) && g.cfg.GlobalBudget == (facade.Budget{}) {
+		return req, nil
+	}
+	spend, err := g.limiter.Spend(tenant)
+	if err != nil {
+		return req, err
+	}
+	for _, l := range g.limits(tenant, spend) {
+		if l.budget == 0 || l.spent < l.budget {
+			continue
+		}
+		restricted, err := f.Restrict(req, g.cfg.BudgetAction, g.cfg.ExpensivePrice)
+		if err != nil {
+			return req, fmt.Errorf("%w: %s", err, l)
+		}
+		log.Printf("Over budget (%s); calling only %v", l, restricted.Providers)
+		return restricted, nil
+	}
+	return req, nil
+}
+
+// Record adds cost to tenant's and the global spend, alerting on each
+// threshold the new totals crossed. Failures are only logged; the money
+// is already spent.
+func (g *Guard) Record(tenant string, cost float64) {
+	if cost <= 0 {
+		return
+	}
+	spend, err := g.limiter.AddSpend(tenant, cost)
+	if err != nil {
+		log.Printf("Failed to record spend of tenant %q: %v", tenant, err)
+		return
+	}
+	for _, l := range g.limits(tenant, spend) {
+		if l.budget == 0 {
+			continue
+		}
+		for _, pct := range g.cfg.BudgetAlertThresholds {
+			at := l.budget * float64(pct) / 100
+			if l.spent-cost >= at || l.spent < at {
+				continue
+			}
+			alert := Alert{Scope: l.scope, Tenant: l.tenant, Period: l.period, Threshold: pct, Spent: l.spent, Budget: l.budget, Time: time.Now().UTC()}
+			if pct >= 100 {
+				alert.Action = g.cfg.BudgetAction
+			}
+			g.alert(alert)
+		}
+	}
+}
+
+// alert logs a and sends it to the webhook in the background
+func (g *Guard) alert(a Alert) {
+	who := "global"
+	if a.Scope == ScopeTenant {
+		who = fmt.Sprintf("tenant %q", a.Tenant)
+	}
+	log.Printf("Budget alert: %s has spent $%.4f, %d%% of its %s budget of $%.2f", who, a.Spent, a.Threshold, a.Period, a.Budget)
+	if g.cfg.BudgetAlertWebhook == "" {
+		return
+	}
+	go func() {
+		if err := postAlert(g.cfg.BudgetAlertWebhook, a); err != nil {
+			log.Printf("Budget alert webhook %s failed: %v", g.cfg.BudgetAlertWebhook, err)
+		}
+	}()
+}
+
+// postAlert sends a to url as JSON
+func postAlert(url string, a Alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	resp, err := webhookClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package budget
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/facade"
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/ratelimit"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// stubClient is a provider whose default model is model
+type stubClient struct{ source, model string }
+
+func (c *stubClient) Source() string       { return c.source }
+func (c *stubClient) DefaultModel() string { return c.model }
+func (c *stubClient) Call(ctx context.Context, req facade.Request) facade.ApiResponse {
+	return facade.ApiResponse{Source: c.source, Message: "ok"}
+}
+
+func init() {
+	for _, stub := range []*stubClient{
+		{source: "Pricey", model: "gpt-4o"},
+		{source: "Thrifty", model: "gemini-1.5-flash"},
+	} {
+		stub := stub
+		facade.Register(stub.source, func(*facade.Config) (facade.AIClient, error) { return stub, nil })
+	}
+}
+
+// newTestGuard returns a Guard over a fresh miniredis and the facade it
+// restricts. It posts alerts to a test webhook, whose requests arrive on
+// the returned channel.
+func newTestGuard(t *testing.T, cfg *facade.Config) (*Guard, *facade.Facade, <-chan Alert) {
+	t.Helper()
+	limiter, err := ratelimit.New("redis://" + miniredis.RunT(t).Addr())
+	if err != nil {
+		t.Fatalf("ratelimit.New: %v", err)
+	}
+	t.Cleanup(func() { limiter.Close() })
+
+	alerts := make(chan Alert, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a Alert
+		if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+			t.Errorf("decode alert: %v", err)
+		}
+		alerts <- a
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg.Providers = []string{"pricey", "thrifty"}
+	cfg.Prices = facade.DefaultPrices
+	cfg.BudgetAlertWebhook = srv.URL
+	if cfg.BudgetAlertThresholds == nil {
+		cfg.BudgetAlertThresholds = []int{50, 80, 100}
+	}
+	if cfg.BudgetAction == "" {
+		cfg.BudgetAction = facade.BudgetReject
+	}
+	f, err := facade.NewFacade(cfg)
+	if err != nil {
+		t.Fatalf("NewFacade: %v", err)
+	}
+	return New(limiter, cfg), f, alerts
+}
+
+// expectAlerts receives an alert for each threshold in want and fails if
+// another one follows. Alerts are posted concurrently, so they are
+// returned sorted by threshold.
+func expectAlerts(t *testing.T, alerts <-chan Alert, want ...int) []Alert {
+	t.Helper()
+	var got []Alert
+	for range want {
+		select {
+		case a := <-alerts:
+			got = append(got, a)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got alerts %+v, want thresholds %v", got, want)
+		}
+	}
+	select {
+	case a := <-alerts:
+		t.Fatalf("unexpected alert %+v", a)
+	case <-time.After(50 * time.Millisecond):
+	}
+	sort.Slice(got, func(i, j int) bool { return got[i].Threshold < got[j].Threshold })
+	for i, a := range got {
+		if a.Threshold != want[i] {
+			t.Fatalf("got alerts %+v, want thresholds %v", got, want)
+		}
+	}
+	return got
+}
+
+func TestRecordAlertsOnceEachThreshold(t *testing.T) {
+	g, _, alerts := newTestGuard(t, &facade.Config{
+		TenantBudget: facade.Budget{Daily: 1},
+		BudgetAction: facade.BudgetCheapest,
+	})
+
+	g.Record("acme", 0.4)
+	expectAlerts(t, alerts)
+	g.Record("acme", 0.2)
+	first := expectAlerts(t, alerts, 50)
+	if a := first[0]; a.Scope != ScopeTenant || a.Tenant != "acme" || a.Period != ratelimit.PeriodDay || a.Budget != 1 || a.Action != "" {
+		t.Errorf("alert = %+v", a)
+	}
+
+	// One record crossing two thresholds raises both
+	g.Record("acme", 0.5)
+	last := expectAlerts(t, alerts, 80, 100)
+	if a := last[1]; a.Action != facade.BudgetCheapest || a.Spent < 1 {
+		t.Errorf("alert = %+v, want the budget action from 100%%", a)
+	}
+
+	g.Record("acme", 0.5)
+	expectAlerts(t, alerts)
+	// Other tenants have budgets of their own
+	g.Record("globex", 0.5)
+	expectAlerts(t, alerts, 50)
+}
+
+func TestRecordGlobalAlerts(t *testing.T) {
+	g, _, alerts := newTestGuard(t, &facade.Config{
+		GlobalBudget:          facade.Budget{Monthly: 10},
+		BudgetAlertThresholds: []int{90},
+	})
+
+	g.Record("acme", 5)
+	g.Record("globex", 3.5)
+	expectAlerts(t, alerts)
+	g.Record("initech", 1)
+	if a := expectAlerts(t, alerts, 90)[0]; a.Scope != ScopeGlobal || a.Tenant != "" || a.Period != ratelimit.PeriodMonth {
+		t.Errorf("alert = %+v", a)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	req := facade.Request{Messages: facade.PromptMessages("", "hi")}
+	for _, tc := range []struct {
+		name      string
+		action    string
+		spent     float64
+		providers []string // Providers left to call; nil when refused
+	}{
+		{name: "under budget", action: facade.BudgetReject, spent: 0.99},
+		{name: "reject", action: facade.BudgetReject, spent: 1},
+		{name: "cheapest", action: facade.BudgetCheapest, spent: 1, providers: []string{"Thrifty"}},
+		{name: "skip expensive", action: facade.BudgetSkipExpensive, spent: 2, providers: []string{"Thrifty"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g, f, _ := newTestGuard(t, &facade.Config{
+				TenantBudgets:         map[string]facade.Budget{"acme": {Daily: 1}},
+				BudgetAction:          tc.action,
+				ExpensivePrice:        5,
+				BudgetAlertThresholds: []int{},
+			})
+			g.Record("acme", tc.spent)
+
+			got, err := g.Check(f, "acme", req)
+			switch {
+			case tc.spent < 1:
+				if err != nil || !reflect.DeepEqual(got, req) {
+					t.Errorf("Check = %+v, %v; want the request unchanged", got, err)
+				}
+			case tc.providers == nil:
+				if !errors.Is(err, facade.ErrOverBudget) || !strings.Contains(err.Error(), `tenant "acme"`) {
+					t.Errorf("err = %v, want ErrOverBudget naming the tenant", err)
+				}
+			case err != nil || !reflect.DeepEqual(got.Providers, tc.providers):
+				t.Errorf("Check = %v, %v; want providers %v", got.Providers, err, tc.providers)
+			}
+
+			// The budget is acme's alone
+			if got, err := g.Check(f, "globex", req); err != nil || got.Providers != nil {
+				t.Errorf("other tenant: Check = %v, %v", got.Providers, err)
+			}
+		})
+	}
+}
+
+func TestCheckWithoutBudgets(t *testing.T) {
+	// With no budget configured Check does not touch Redis
+	g := New(nil, &facade.Config{})
+	req := facade.Request{Messages: facade.PromptMessages("", "hi")}
+	if got, err := g.Check(nil, "acme", req); err != nil || !reflect.DeepEqual(got, req) {
+		t.Errorf("Check = %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,253 @@
+package facade
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+func init() {
+	Register("anthropic", func(cfg *Config) (AIClient, error) {
+		if cfg.AnthropicKey == "" {
+			return nil, fmt.Errorf("missing ANTHROPIC_API_KEY")
+		}
+		return NewAnthropicClient(cfg), nil
+	})
+}
+
+// AnthropicClient implements AIClient for the Anthropic Messages API
+type AnthropicClient struct {
+	breakerClient
+	maxTokens    int
+	systemPrompt string
+}
+
+func NewAnthropicClient(cfg *Config) *AnthropicClient {
+	return &AnthropicClient{
+		breakerClient: breakerClient{
+			httpClient: &http.Client{Timeout: cfg.Timeout},
+			apiKey:     cfg.AnthropicKey,
+			url:        cfg.AnthropicURL,
+			headers: map[string]string{
+				"x-api-key":         cfg.AnthropicKey,
+				"anthropic-version": cfg.AnthropicVersion,
+			},
+			model:         cfg.AnthropicModel,
+			maxRetries:    cfg.MaxRetries,
+			retryDelay:    cfg.RetryDelay,
+			maxRetryDelay: cfg.MaxRetryDelay,
+			cb:            newBreaker("Anthropic"),
+		},
+		maxTokens:    cfg.AnthropicMaxTokens,
+		systemPrompt: cfg.AnthropicSystemPrompt,
+	}
+}
+
+// anthropicRequest is the Messages API request body
+type anthropicRequest struct {
+	Model         string             `json:"model"`
+	MaxTokens     int                `json:"max_tokens"`
+	System        string             `json:"system,omitempty"`
+	Messages      []anthropicMessage `json:"messages"`
+	Temperature   *float64           `json:"temperature,omitempty"`
+	TopP          *float64           `json:"top_p,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Stream        bool               `json:"stream,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// anthropicResponse is the Messages API response body
+type anthropicResponse struct {
+	Type    string `json:"type"`
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	StopReason string          `json:"stop_reason"`
+	Model      string          `json:"model"`
+	Usage      *anthropicUsage `json:"usage"`
+	Error      *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// anthropicUsage is the token usage reported by the Messages API
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+func (u *anthropicUsage) toUsage() *Usage {
+	if u == nil {
+		return nil
+	}
+	return &Usage{InputTokens: u.InputTokens, OutputTokens: u.OutputTokens}
+}
+
+// Call sends the request to the Messages API. The API has no seed
+// parameter, so GenerationOptions.Seed is ignored.
+func (c *AnthropicClient) Call(ctx context.Context, req Request) ApiResponse {
+	body, err := callAPI(ctx, c.Source(), c.url, c.headers, c.maxRetries, c.retryDelay, c.maxRetryDelay, c.newRequest(req), c.httpClient, c.cb)
+	if err != nil {
+		return ApiResponse{Source: c.Source(), Error: err.Error()}
+	}
+	return decodeAnthropic(c.Source(), body)
+}
+
+// Stream implements Streamer using the Messages API's SSE events
+func (c *AnthropicClient) Stream(ctx context.Context, req Request) (<-chan StreamEvent, error) {
+	payload := c.newRequest(req)
+	payload.Stream = true
+	body, err := openStream(ctx, c.Source(), c.url, c.headers, c.maxRetries, c.retryDelay, c.maxRetryDelay, payload, c.httpClient, c.cb)
+	if err != nil {
+		return nil, err
+	}
+	return pumpStream(ctx, c.Source(), body, anthropicStream(body)), nil
+}
+
+func (c *AnthropicClient) newRequest(req Request) anthropicRequest {
+	system, messages := toAnthropicMessages(c.systemPrompt, req.Messages)
+	payload := anthropicRequest{
+		Model:         req.Options.ModelFor(c.Source(), c.model),
+		MaxTokens:     c.maxTokens,
+		System:        system,
+		Messages:      messages,
+		Temperature:   req.Options.Temperature,
+		TopP:          req.Options.TopP,
+		StopSequences: req.Options.Stop,
+	}
+	if req.Options.MaxTokens > 0 {
+		payload.MaxTokens = req.Options.MaxTokens
+	}
+	return payload
+}
+
+func (c *AnthropicClient) Source() string {
+	return "Anthropic"
+}
+
+// toAnthropicMessages lifts system turns into the top-level system prompt,
+// after the configured one, and merges consecutive turns of the same role
+// since the Messages API expects user and assistant to alternate.
+func toAnthropicMessages(configured string, msgs []ChatMessage) (string, []anthropicMessage) {
+	var system []string
+	if configured != "" {
+		system = append(system, configured)
+	}
+	var out []anthropicMessage
+	for _, m := range msgs {
+		if m.Role == RoleSystem {
+			system = append(system, m.Content)
+			continue
+		}
+		if n := len(out); n > 0 && out[n-1].Role == m.Role {
+			out[n-1].Content += "\n\n" + m.Content
+			continue
+		}
+		out = append(out, anthropicMessage{Role: m.Role, Content: m.Content})
+	}
+	return strings.Join(system, "\n\n"), out
+}
+
+// decodeAnthropic turns a Messages API body into an ApiResponse, joining
+// the text content blocks and skipping non-text ones such as tool_use.
+func decodeAnthropic(source string, body []byte) ApiResponse {
+	var result anthropicResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return ApiResponse{Source: source, Error: fmt.Sprintf("decode error: %v", err)}
+	}
+	if result.Error != nil {
+		return ApiResponse{Source: source, Error: fmt.Sprintf("provider error: %s: %s", result.Error.Type, result.Error.Message)}
+	}
+	if len(result.Content) == 0 {
+		return ApiResponse{Source: source, FinishReason: result.StopReason, Model: result.Model, Usage: result.Usage.toUsage(), Error: "no content in response"}
+	}
+
+	var text strings.Builder
+	for _, block := range result.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	resp := ApiResponse{
+		Source:       source,
+		Message:      text.String(),
+		FinishReason: result.StopReason,
+		Model:        result.Model,
+		Usage:        result.Usage.toUsage(),
+	}
+	if result.StopReason == "refusal" {
+		resp.Safety = &SafetyBlock{Reason: result.StopReason}
+		if resp.Message == "" {
+			resp.Error = "response refused by safety system"
+		}
+	}
+	return resp
+}
+
+// anthropicStreamEvent covers the fields used from the Messages API's
+// message_start, content_block_delta, message_delta and error events
+type anthropicStreamEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		Model string          `json:"model"`
+		Usage *anthropicUsage `json:"usage"`
+	} `json:"message"`
+	Delta struct {
+		Type       string `json:"type"`
+		Text       string `json:"text"`
+		StopReason string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage *anthropicUsage `json:"usage"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// anthropicStream decodes a Messages API event stream
+func anthropicStream(body io.Reader) func() (streamChunk, error) {
+	sse := newSSEReader(body)
+	return func() (streamChunk, error) {
+		for {
+			ev, err := sse.Next()
+			if err != nil {
+				return streamChunk{}, err
+			}
+			var frame anthropicStreamEvent
+			if err := json.Unmarshal([]byte(ev.Data), &frame); err != nil {
+				return streamChunk{}, fmt.Errorf("decode error: %v", err)
+			}
+			switch frame.Type {
+			case "message_start":
+				// Input tokens are counted here, output tokens in message_delta
+				return streamChunk{Model: frame.Message.Model, Usage: frame.Message.Usage.toUsage()}, nil
+			case "content_block_delta":
+				if frame.Delta.Type == "text_delta" {
+					return streamChunk{Delta: frame.Delta.Text}, nil
+				}
+			case "message_delta":
+				chunk := streamChunk{FinishReason: frame.Delta.StopReason, Usage: frame.Usage.toUsage()}
+				if chunk.FinishReason == "refusal" {
+					chunk.Safety = &SafetyBlock{Reason: chunk.FinishReason}
+				}
+				return chunk, nil
+			case "message_stop":
+				return streamChunk{Done: true}, nil
+			case "error":
+				if frame.Error != nil {
+					return streamChunk{}, fmt.Errorf("provider error: %s: %s", frame.Error.Type, frame.Error.Message)
+				}
+				return streamChunk{}, fmt.Errorf("provider error")
+			}
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package facade
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// anthropicServer answers every request with status and body, passing
+// each request to check first
+func anthropicServer(t *testing.T, status int, body string, check func(*http.Request)) *AnthropicClient {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if check != nil {
+			check(r)
+		}
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "7")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return NewAnthropicClient(&Config{
+		AnthropicKey:          "test-key",
+		AnthropicURL:          srv.URL,
+		AnthropicVersion:      "2023-06-01",
+		AnthropicModel:        "claude-3-5-haiku-latest",
+		AnthropicMaxTokens:    1024,
+		AnthropicSystemPrompt: "Be brief.",
+		Timeout:               5 * time.Second,
+		MaxRetries:            1,
+	})
+}
+
+func TestAnthropicCall(t *testing.T) {
+	var got anthropicRequest
+	c := anthropicServer(t, http.StatusOK, `{
+		"type": "message",
+		"model": "claude-3-5-haiku-20241022",
+		"content": [
+			{"type": "text", "text": "Hello"},
+			{"type": "tool_use", "id": "t1", "name": "lookup", "input": {}},
+			{"type": "text", "text": " world"}
+		],
+		"stop_reason": "end_turn",
+		"usage": {"input_tokens": 12, "output_tokens": 3}
+	}`, func(r *http.Request) {
+		if h := r.Header.Get("x-api-key"); h != "test-key" {
+			t.Errorf("x-api-key = %q", h)
+		}
+		if h := r.Header.Get("anthropic-version"); h != "2023-06-01" {
+			t.Errorf("anthropic-version = %q", h)
+		}
+		if h := r.Header.Get("Authorization"); h != "" {
+			t.Errorf("unexpected Authorization header %q", h)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+	})
+
+	resp := c.Call(context.Background(), Request{Messages: []ChatMessage{
+		{Role: RoleSystem, Content: "Answer in English."},
+		{Role: RoleUser, Content: "Hi"},
+		{Role: RoleUser, Content: "Anyone there?"},
+		{Role: RoleAssistant, Content: "Yes."},
+		{Role: RoleUser, Content: "Greet me"},
+	}})
+
+	if got.System != "Be brief.\n\nAnswer in English." {
+		t.Errorf("system = %q", got.System)
+	}
+	wantMessages := []anthropicMessage{
+		{Role: RoleUser, Content: "Hi\n\nAnyone there?"},
+		{Role: RoleAssistant, Content: "Yes."},
+		{Role: RoleUser, Content: "Greet me"},
+	}
+	if !reflect.DeepEqual(got.Messages, wantMessages) {
+		t.Errorf("messages = %+v, want %+v", got.Messages, wantMessages)
+	}
+	if got.Model != "claude-3-5-haiku-latest" || got.MaxTokens != 1024 {
+		t.Errorf("model = %q, max_tokens = %d", got.Model, got.MaxTokens)
+	}
+
+	if resp.Error != "" {
+		t.Fatalf("unexpected error %q", resp.Error)
+	}
+	if resp.Message != "Hello world" || resp.FinishReason != "end_turn" || resp.Model != "claude-3-5-haiku-20241022" {
+		t.Errorf("response = %+v", resp)
+	}
+	if resp.Usage == nil || *resp.Usage != (Usage{InputTokens: 12, OutputTokens: 3}) {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+}
+
+func TestAnthropicOptionsOverrideDefaults(t *testing.T) {
+	var got anthropicRequest
+	c := anthropicServer(t, http.StatusOK, `{"content":[{"type":"text","text":"ok"}],"stop_reason":"max_tokens"}`, func(r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+	})
+	temp := 0.2
+	resp := c.Call(context.Background(), Request{
+		Messages: PromptMessages("", "hi"),
+		Options: GenerationOptions{
+			Models:      map[string]string{"anthropic": "claude-3-5-sonnet-latest"},
+			MaxTokens:   50,
+			Temperature: &temp,
+			Stop:        []string{"END"},
+		},
+	})
+	if resp.FinishReason != "max_tokens" {
+		t.Errorf("finish reason = %q", resp.FinishReason)
+	}
+	if got.Model != "claude-3-5-sonnet-latest" || got.MaxTokens != 50 || got.Temperature == nil || *got.Temperature != 0.2 ||
+		!reflect.DeepEqual(got.StopSequences, []string{"END"}) {
+		t.Errorf("request = %+v", got)
+	}
+}
+
+func TestAnthropicErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		status int
+		body   string
+		want   ProviderError
+	}{
+		{
+			name:   "rate limited",
+			status: http.StatusTooManyRequests,
+			body:   `{"type":"error","error":{"type":"rate_limit_error","message":"Number of requests has exceeded your rate limit"}}`,
+			want: ProviderError{Provider: "Anthropic", StatusCode: 429, Code: "rate_limit_error",
+				Message: "Number of requests has exceeded your rate limit", Retryable: true, RetryAfter: 7 * time.Second},
+		},
+		{
+			name:   "invalid request",
+			status: http.StatusBadRequest,
+			body:   `{"type":"error","error":{"type":"invalid_request_error","message":"max_tokens: field required"}}`,
+			want: ProviderError{Provider: "Anthropic", StatusCode: 400, Code: "invalid_request_error",
+				Message: "max_tokens: field required"},
+		},
+		{
+			name:   "overloaded",
+			status: 529,
+			body:   `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+			want: ProviderError{Provider: "Anthropic", StatusCode: 529, Code: "overloaded_error",
+				Message: "Overloaded", Retryable: true},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := anthropicServer(t, tc.status, tc.body, nil)
+			_, err := callAPI(context.Background(), c.Source(), c.url, c.headers, c.maxRetries, c.retryDelay, c.maxRetryDelay,
+				c.newRequest(Request{Messages: PromptMessages("", "hi")}), c.httpClient, c.cb)
+			var perr *ProviderError
+			if !errors.As(err, &perr) {
+				t.Fatalf("err = %v, want a *ProviderError", err)
+			}
+			if *perr != tc.want {
+				t.Errorf("got %+v, want %+v", *perr, tc.want)
+			}
+
+			resp := c.Call(context.Background(), Request{Messages: PromptMessages("", "hi")})
+			if !strings.Contains(resp.Error, tc.want.Error()) {
+				t.Errorf("Call error = %q, want it to contain %q", resp.Error, tc.want.Error())
+			}
+		})
+	}
+}
+
+func TestDecodeAnthropic(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		body string
+		want ApiResponse
+	}{
+		{
+			name: "refusal",
+			body: `{"content":[],"stop_reason":"refusal","model":"claude-3-5-sonnet"}`,
+			want: ApiResponse{Source: "Anthropic", FinishReason: "refusal", Model: "claude-3-5-sonnet", Error: "no content in response"},
+		},
+		{
+			name: "refusal with text",
+			body: `{"content":[{"type":"text","text":"I can't help with that."}],"stop_reason":"refusal"}`,
+			want: ApiResponse{Source: "Anthropic", Message: "I can't help with that.", FinishReason: "refusal",
+				Safety: &SafetyBlock{Reason: "refusal"}},
+		},
+		{
+			name: "error in 200 body",
+			body: `{"type":"error","error":{"type":"api_error","message":"Internal error"}}`,
+			want: ApiResponse{Source: "Anthropic", Error: "provider error: api_error: Internal error"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := decodeAnthropic("Anthropic", []byte(tc.body)); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package facade
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// What to do with a request once a spend budget is used up, selected with
+// BUDGET_ACTION
+const (
+	BudgetReject        = "reject"         // Refuse the request
+	BudgetCheapest      = "cheapest"       // Call only the cheapest provider
+	BudgetSkipExpensive = "skip-expensive" // Leave out providers whose model costs ExpensivePrice or more
+)
+
+// BudgetActions lists the valid BUDGET_ACTION values
+var BudgetActions = []string{BudgetReject, BudgetCheapest, BudgetSkipExpensive}
+
+// ErrOverBudget is returned for requests refused because a budget is used up
+var ErrOverBudget = errors.New("spend budget exhausted")
+
+// Budget caps spend in USD per UTC day and month. Zero means unlimited.
+type Budget struct {
+	Daily   float64
+	Monthly float64
+}
+
+// Restrict narrows req for a caller whose budget is used up, following
+// action. The judge is one more paid call, so the judge strategy falls
+// back to consensus under BudgetCheapest, or under BudgetSkipExpensive
+// when the judge's model is expensive. Models missing from the price
+// table count as free. It returns ErrOverBudget for BudgetReject, or when
+// no provider is left to call.
+func (f *Facade) Restrict(req Request, action string, expensivePrice float64) (Request, error) {
+	clients := f.clientsFor(req)
+	var keep []string
+	switch action {
+	case BudgetCheapest:
+		var cheapest AIClient
+		var lowest float64
+		for _, c := range clients {
+			p := f.price(c, req)
+			if cost := p.Input + p.Output; cheapest == nil || cost < lowest {
+				cheapest, lowest = c, cost
+			}
+		}
+		if cheapest != nil {
+			keep = []string{cheapest.Source()}
+		}
+	case BudgetSkipExpensive:
+		for _, c := range clients {
+			if f.price(c, req).Output < expensivePrice {
+				keep = append(keep, c.Source())
+			}
+		}
+	}
+	if len(keep) == 0 {
+		return req, ErrOverBudget
+	}
+	req.Providers = keep
+	if req.Merge.strategy() == StrategyJudge && (action == BudgetCheapest || f.judgePrice().Output >= expensivePrice) {
+		req.Merge.Strategy = StrategyConsensus
+	}
+	return req, nil
+}
+
+// price returns what c charges for req's model, or zero when it is not in
+// the price table
+func (f *Facade) price(c AIClient, req Request) Price {
+	source := strings.ToLower(c.Source())
+	p, _ := priceFor(f.prices, req.Options.ModelFor(source, f.models[source]))
+	return p
+}
+
+// judgePrice returns what the judge charges, or zero when there is no judge
+// or its model is not in the price table
+func (f *Facade) judgePrice() Price {
+	if f.judgeClient == nil {
+		return Price{}
+	}
+	model := f.judgeModel
+	if model == "" {
+		model = defaultModel(f.judgeClient)
+	}
+	p, _ := priceFor(f.prices, model)
+	return p
+}
+
+// checkBudgetAction fails unless action is one of BudgetActions
+func checkBudgetAction(action string) error {
+	for _, a := range BudgetActions {
+		if action == a {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid BUDGET_ACTION %q, want one of %s", action, strings.Join(BudgetActions, ", "))
+}
@@ -0,0 +1,83 @@
+package facade
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// restrictFacade has a cheap, a mid-priced and an expensive provider, and
+// judgeModel as its judge
+func restrictFacade(judgeModel string) *Facade {
+	return &Facade{
+		clients: []AIClient{
+			&fakeClient{resp: ApiResponse{Source: "OpenAI"}},
+			&fakeClient{resp: ApiResponse{Source: "Gemini"}},
+			&fakeClient{resp: ApiResponse{Source: "Anthropic"}},
+		},
+		models: map[string]string{
+			"openai":    "gpt-4o",
+			"gemini":    "gemini-1.5-flash",
+			"anthropic": "claude-3-5-haiku",
+		},
+		prices:      DefaultPrices,
+		judgeClient: &fakeClient{resp: ApiResponse{Source: "OpenAI"}},
+		judgeModel:  judgeModel,
+	}
+}
+
+func TestRestrict(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		action    string
+		providers []string
+		judge     string // Judge model; empty for no judge strategy
+		want      []string
+		strategy  string
+		err       error
+	}{
+		{name: "reject", action: BudgetReject, err: ErrOverBudget},
+		{name: "cheapest", action: BudgetCheapest, want: []string{"Gemini"}},
+		{name: "skip expensive", action: BudgetSkipExpensive, want: []string{"Gemini", "Anthropic"}},
+		{name: "skip expensive, only expensive requested", action: BudgetSkipExpensive, providers: []string{"openai"}, err: ErrOverBudget},
+		{name: "cheapest drops judge", action: BudgetCheapest, judge: "gpt-4o-mini", want: []string{"Gemini"}, strategy: StrategyConsensus},
+		{name: "expensive judge dropped", action: BudgetSkipExpensive, judge: "gpt-4o", want: []string{"Gemini", "Anthropic"}, strategy: StrategyConsensus},
+		{name: "cheap judge kept", action: BudgetSkipExpensive, judge: "gpt-4o-mini", want: []string{"Gemini", "Anthropic"}, strategy: StrategyJudge},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := restrictFacade(tc.judge)
+			req := Request{Messages: PromptMessages("", "hi"), Providers: tc.providers}
+			if tc.judge != "" {
+				req.Merge.Strategy = StrategyJudge
+			}
+			got, err := f.Restrict(req, tc.action, 5)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("err = %v, want %v", err, tc.err)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(got.Providers, tc.want) {
+				t.Errorf("Providers = %v, want %v", got.Providers, tc.want)
+			}
+			if tc.strategy != "" && got.Merge.Strategy != tc.strategy {
+				t.Errorf("Strategy = %q, want %q", got.Merge.Strategy, tc.strategy)
+			}
+		})
+	}
+}
+
+func TestRestrictUsesRequestedModel(t *testing.T) {
+	f := restrictFacade("")
+	req := Request{
+		Messages: PromptMessages("", "hi"),
+		Options:  GenerationOptions{Models: map[string]string{"openai": "gpt-4o-mini"}},
+	}
+	got, err := f.Restrict(req, BudgetSkipExpensive, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"OpenAI", "Gemini", "Anthropic"}; !reflect.DeepEqual(got.Providers, want) {
+		t.Errorf("Providers = %v, want %v", got.Providers, want)
+	}
+}
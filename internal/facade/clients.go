@@ -2,9 +2,13 @@ package facade
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/avast/retry-go/v4"
@@ -13,18 +17,84 @@ import (
 
 // AIClient defines the interface for AI API clients
 type AIClient interface {
-	Call(prompt string) ApiResponse
+	// Call sends the request to the provider. It must give up as soon as
+	// ctx is cancelled or its deadline passes.
+	Call(ctx context.Context, req Request) ApiResponse
 	Source() string
 }
 
+func init() {
+	Register("openai", func(cfg *Config) (AIClient, error) {
+		if cfg.OpenAIKey == "" {
+			return nil, fmt.Errorf("missing OPENAI_API_KEY")
+		}
+		return NewOpenAIClient(cfg), nil
+	})
+	Register("huggingface", func(cfg *Config) (AIClient, error) {
+		if cfg.HuggingFaceKey == "" {
+			return nil, fmt.Errorf("missing HUGGINGFACE_API_KEY")
+		}
+		return NewHuggingFaceClient(cfg), nil
+	})
+	Register("gemini", func(cfg *Config) (AIClient, error) {
+		if cfg.GeminiKey == "" {
+			return nil, fmt.Errorf("missing GEMINI_API_KEY")
+		}
+		return NewGeminiClient(cfg), nil
+	})
+}
+
+// BreakerSettings tunes a provider's circuit breaker
+type BreakerSettings struct {
+	MaxRequests uint32        // Requests allowed through in half-open state
+	Interval    time.Duration // Period after which failure counts reset in closed state
+	Timeout     time.Duration // How long the breaker stays open before half-open
+	MaxFailures uint32        // Consecutive failures tolerated before tripping
+}
+
+// DefaultBreakerSettings are the breaker settings shared by built-in providers
+var DefaultBreakerSettings = BreakerSettings{
+	MaxRequests: 2,                // Half-open state allows 2 requests to test recovery
+	Interval:    60 * time.Second, // Reset failure count every 60s in closed state
+	Timeout:     30 * time.Second, // Open state lasts 30s before half-open
+	MaxFailures: 5,                // Trip after 5 consecutive failures
+}
+
+// newBreaker returns a circuit breaker with the default settings
+func newBreaker(name string) *gobreaker.CircuitBreaker {
+	return newBreakerWith(name, DefaultBreakerSettings)
+}
+
+// newBreakerWith returns a circuit breaker with the given settings
+func newBreakerWith(name string, st BreakerSettings) *gobreaker.CircuitBreaker {
+	return gobreaker.NewCircuitBreaker(gobreaker.Settings{
+		Name:        name,
+		MaxRequests: st.MaxRequests,
+		Interval:    st.Interval,
+		Timeout:     st.Timeout,
+		ReadyToTrip: func(counts gobreaker.Counts) bool {
+			return counts.ConsecutiveFailures > st.MaxFailures
+		},
+		IsSuccessful: isBreakerSuccess, // Client errors and cancellations don't count
+	})
+}
+
 // Client-specific circuit breaker settings
 type breakerClient struct {
-	httpClient *http.Client
-	apiKey     string
-	url        string
-	maxRetries uint
-	retryDelay time.Duration
-	cb         *gobreaker.CircuitBreaker // New: Circuit breaker instance
+	httpClient    *http.Client
+	apiKey        string
+	url           string
+	headers       map[string]string // Auth and other per-provider request headers
+	model         string            // Default model, overridable per request
+	maxRetries    uint
+	retryDelay    time.Duration
+	maxRetryDelay time.Duration
+	cb            *gobreaker.CircuitBreaker // New: Circuit breaker instance
+}
+
+// DefaultModel returns the model used when a request does not pick one
+func (c *breakerClient) DefaultModel() string {
+	return c.model
 }
 
 // OpenAIClient implements AIClient for OpenAI
@@ -33,41 +103,36 @@ type OpenAIClient struct {
 }
 
 func NewOpenAIClient(cfg *Config) *OpenAIClient {
-	cb := gobreaker.NewCircuitBreaker(gobreaker.Settings{
-		Name:        "OpenAI",
-		MaxRequests: 2,                // Half-open state allows 2 requests to test recovery
-		Interval:    60 * time.Second, // Reset failure count every 60s in closed state
-		Timeout:     30 * time.Second, // Open state lasts 30s before half-open
-		ReadyToTrip: func(counts gobreaker.Counts) bool {
-			return counts.ConsecutiveFailures > 5 // Trip after 5 consecutive failures
-		},
-	})
+	cb := newBreaker("OpenAI")
 	return &OpenAIClient{
 		breakerClient: breakerClient{
-			httpClient: &http.Client{Timeout: cfg.Timeout},
-			apiKey:     cfg.OpenAIKey,
-			url:        cfg.OpenAIURL,
-			maxRetries: cfg.MaxRetries,
-			retryDelay: cfg.RetryDelay,
-			cb:         cb,
+			httpClient:    &http.Client{Timeout: cfg.Timeout},
+			apiKey:        cfg.OpenAIKey,
+			url:           cfg.OpenAIURL,
+			headers:       map[string]string{"Authorization": "Bearer " + cfg.OpenAIKey},
+			model:         cfg.OpenAIModel,
+			maxRetries:    cfg.MaxRetries,
+			retryDelay:    cfg.RetryDelay,
+			maxRetryDelay: cfg.MaxRetryDelay,
+			cb:            cb,
 		},
 	}
 }
 
-func (c *OpenAIClient) Call(prompt string) ApiResponse {
-	payload := map[string]interface{}{
-		"model": "gpt-3.5-turbo-instruct",
-		"messages": []map[string]string{
-			{"role": "user", "content": prompt},
-		},
-	}
-	resp := callAPI(c.url, c.apiKey, "Bearer", c.Source(), c.maxRetries, c.retryDelay, payload, c.httpClient, c.cb)
-	if resp.Error == "" {
-		var result map[string]interface{}
-		json.Unmarshal([]byte(resp.Message), &result)
-		resp.Message = result["choices"].([]interface{})[0].(map[string]interface{})["message"].(map[string]interface{})["content"].(string)
+func (c *OpenAIClient) Call(ctx context.Context, req Request) ApiResponse {
+	payload := newChatCompletionRequest(req.Options.ModelFor(c.Source(), c.model), req)
+	body, err := callAPI(ctx, c.Source(), c.url, c.headers, c.maxRetries, c.retryDelay, c.maxRetryDelay, payload, c.httpClient, c.cb)
+	if err != nil {
+		return ApiResponse{Source: c.Source(), Error: err.Error()}
 	}
-	return resp
+	return decodeChatCompletion(c.Source(), body)
+}
+
+// Stream implements Streamer
+func (c *OpenAIClient) Stream(ctx context.Context, req Request) (<-chan StreamEvent, error) {
+	payload := newChatCompletionRequest(req.Options.ModelFor(c.Source(), c.model), req)
+	payload.StreamOpts = &streamOpts{IncludeUsage: true} // Not every compatible server accepts it
+	return c.streamChatCompletion(ctx, c.Source(), payload)
 }
 
 func (c *OpenAIClient) Source() string {
@@ -80,59 +145,34 @@ type HuggingFaceClient struct {
 }
 
 func NewHuggingFaceClient(cfg *Config) *HuggingFaceClient {
-	cb := gobreaker.NewCircuitBreaker(gobreaker.Settings{
-		Name:        "HuggingFace",
-		MaxRequests: 2,
-		Interval:    60 * time.Second,
-		Timeout:     30 * time.Second,
-		ReadyToTrip: func(counts gobreaker.Counts) bool {
-			return counts.ConsecutiveFailures > 5
-		},
-	})
+	cb := newBreaker("HuggingFace")
 	return &HuggingFaceClient{
 		breakerClient: breakerClient{
-			httpClient: &http.Client{Timeout: cfg.Timeout},
-			apiKey:     cfg.HuggingFaceKey,
-			url:        cfg.HuggingFaceURL,
-			maxRetries: cfg.MaxRetries,
-			retryDelay: cfg.RetryDelay,
-			cb:         cb,
+			httpClient:    &http.Client{Timeout: cfg.Timeout},
+			apiKey:        cfg.HuggingFaceKey,
+			url:           cfg.HuggingFaceURL,
+			headers:       map[string]string{"Authorization": "Bearer " + cfg.HuggingFaceKey},
+			model:         cfg.HuggingFaceModel,
+			maxRetries:    cfg.MaxRetries,
+			retryDelay:    cfg.RetryDelay,
+			maxRetryDelay: cfg.MaxRetryDelay,
+			cb:            cb,
 		},
 	}
 }
 
-func (c *HuggingFaceClient) Call(prompt string) ApiResponse {
-	payload := map[string]interface{}{
-		"messages": []map[string]string{
-			{
-				"role":    "user",
-				"content": prompt,
-			},
-		},
-		"model":  "deepseek/deepseek-v3-0324",
-		"stream": false,
+func (c *HuggingFaceClient) Call(ctx context.Context, req Request) ApiResponse {
+	payload := newChatCompletionRequest(req.Options.ModelFor(c.Source(), c.model), req)
+	body, err := callAPI(ctx, c.Source(), c.url, c.headers, c.maxRetries, c.retryDelay, c.maxRetryDelay, payload, c.httpClient, c.cb)
+	if err != nil {
+		return ApiResponse{Source: c.Source(), Error: err.Error()}
 	}
+	return decodeChatCompletion(c.Source(), body)
+}
 
-	resp := callAPI(c.url, c.apiKey, "Bearer", c.Source(), c.maxRetries, c.retryDelay, payload, c.httpClient, c.cb)
-	if resp.Error == "" {
-		var result map[string]interface{}
-		json.Unmarshal([]byte(resp.Message), &result)
-		choices, ok := result["choices"].([]interface{})
-		if !ok || len(choices) == 0 {
-			fmt.Errorf("no choices in HuggingFace response")
-		}
-		message, ok := choices[0].(map[string]interface{})["message"].(map[string]interface{})
-		if !ok {
-			fmt.Errorf("invalid HuggingFace response format")
-		}
-		content, ok := message["content"].(string)
-		if !ok {
-			fmt.Errorf("no content in HuggingFace response")
-		}
-
-		resp.Message = content
-	}
-	return resp
+// Stream implements Streamer
+func (c *HuggingFaceClient) Stream(ctx context.Context, req Request) (<-chan StreamEvent, error) {
+	return c.streamChatCompletion(ctx, c.Source(), newChatCompletionRequest(req.Options.ModelFor(c.Source(), c.model), req))
 }
 
 func (c *HuggingFaceClient) Source() string {
@@ -145,112 +185,239 @@ type GeminiClient struct {
 }
 
 func NewGeminiClient(cfg *Config) *GeminiClient {
-	cb := gobreaker.NewCircuitBreaker(gobreaker.Settings{
-		Name:        "Gemini",
-		MaxRequests: 2,
-		Interval:    60 * time.Second,
-		Timeout:     30 * time.Second,
-		ReadyToTrip: func(counts gobreaker.Counts) bool {
-			return counts.ConsecutiveFailures > 5
-		},
-	})
+	cb := newBreaker("Gemini")
 	return &GeminiClient{
 		breakerClient: breakerClient{
-			httpClient: &http.Client{Timeout: cfg.Timeout},
-			apiKey:     cfg.GeminiKey,
-			url:        fmt.Sprintf("%s?key=%s", cfg.GeminiURL, cfg.GeminiKey),
-			maxRetries: cfg.MaxRetries,
-			retryDelay: cfg.RetryDelay,
-			cb:         cb,
+			httpClient:    &http.Client{Timeout: cfg.Timeout},
+			apiKey:        cfg.GeminiKey,
+			url:           strings.TrimRight(cfg.GeminiURL, "/"),
+			headers:       map[string]string{"x-goog-api-key": cfg.GeminiKey},
+			model:         cfg.GeminiModel,
+			maxRetries:    cfg.MaxRetries,
+			retryDelay:    cfg.RetryDelay,
+			maxRetryDelay: cfg.MaxRetryDelay,
+			cb:            cb,
 		},
 	}
 }
 
-func (c *GeminiClient) Call(prompt string) ApiResponse {
-	payload := map[string]interface{}{
-		"contents": []map[string]interface{}{
-			{
-				"parts": []map[string]string{
-					{"text": prompt},
-				},
-			},
-		},
+// geminiRequest is the generateContent request body
+type geminiRequest struct {
+	Contents          []geminiContent         `json:"contents"`
+	SystemInstruction *geminiContent          `json:"systemInstruction,omitempty"`
+	GenerationConfig  *geminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiPart struct {
+	Text string `json:"text"`
+}
+
+type geminiGenerationConfig struct {
+	Temperature     *float64 `json:"temperature,omitempty"`
+	TopP            *float64 `json:"topP,omitempty"`
+	MaxOutputTokens int      `json:"maxOutputTokens,omitempty"`
+	StopSequences   []string `json:"stopSequences,omitempty"`
+	Seed            *int64   `json:"seed,omitempty"`
+}
+
+func (c *GeminiClient) Call(ctx context.Context, req Request) ApiResponse {
+	url := fmt.Sprintf("%s/%s:generateContent", c.url, req.Options.ModelFor(c.Source(), c.model))
+	body, err := callAPI(ctx, c.Source(), url, c.headers, c.maxRetries, c.retryDelay, c.maxRetryDelay, newGeminiRequest(req), c.httpClient, c.cb)
+	if err != nil {
+		return ApiResponse{Source: c.Source(), Error: err.Error()}
 	}
-	resp := callAPI(c.url, "", "", c.Source(), c.maxRetries, c.retryDelay, payload, c.httpClient, c.cb)
-	if resp.Error == "" {
-		var result map[string]interface{}
-		json.Unmarshal([]byte(resp.Message), &result)
-		resp.Message = result["candidates"].([]interface{})[0].(map[string]interface{})["content"].(map[string]interface{})["parts"].([]interface{})[0].(map[string]interface{})["text"].(string)
+	return decodeGemini(c.Source(), body)
+}
+
+// Stream implements Streamer using streamGenerateContent with SSE framing
+func (c *GeminiClient) Stream(ctx context.Context, req Request) (<-chan StreamEvent, error) {
+	url := fmt.Sprintf("%s/%s:streamGenerateContent?alt=sse", c.url, req.Options.ModelFor(c.Source(), c.model))
+	body, err := openStream(ctx, c.Source(), url, c.headers, c.maxRetries, c.retryDelay, c.maxRetryDelay, newGeminiRequest(req), c.httpClient, c.cb)
+	if err != nil {
+		return nil, err
 	}
-	return resp
+	return pumpStream(ctx, c.Source(), body, geminiStream(body)), nil
 }
 
 func (c *GeminiClient) Source() string {
 	return "Gemini"
 }
 
-// callAPI makes HTTP requests with retries
-func callAPI(url, apiKey, authType, source string, maxRetries uint, retryDelay time.Duration,
-	payload interface{}, httpClient *http.Client, cb *gobreaker.CircuitBreaker) ApiResponse {
-	var apiResp ApiResponse
-	err := retry.Do(
-		func() error {
-			jsonPayload, err := json.Marshal(payload)
-			if err != nil {
-				return fmt.Errorf("marshal error: %v", err)
+// newGeminiRequest maps a conversation onto Gemini's contents, where the
+// assistant role is called "model" and system turns go to systemInstruction
+func newGeminiRequest(req Request) geminiRequest {
+	var payload geminiRequest
+	for _, m := range req.Messages {
+		switch m.Role {
+		case RoleSystem:
+			if payload.SystemInstruction == nil {
+				payload.SystemInstruction = &geminiContent{}
 			}
+			payload.SystemInstruction.Parts = append(payload.SystemInstruction.Parts, geminiPart{Text: m.Content})
+		case RoleAssistant:
+			payload.Contents = append(payload.Contents, geminiContent{Role: "model", Parts: []geminiPart{{Text: m.Content}}})
+		default:
+			payload.Contents = append(payload.Contents, geminiContent{Role: "user", Parts: []geminiPart{{Text: m.Content}}})
+		}
+	}
+	if opts := req.Options; opts.Temperature != nil || opts.TopP != nil || opts.MaxTokens > 0 || len(opts.Stop) > 0 || opts.Seed != nil {
+		payload.GenerationConfig = &geminiGenerationConfig{
+			Temperature:     opts.Temperature,
+			TopP:            opts.TopP,
+			MaxOutputTokens: opts.MaxTokens,
+			StopSequences:   opts.Stop,
+			Seed:            opts.Seed,
+		}
+	}
+	return payload
+}
+
+// chatCompletionRequest is the OpenAI chat-completions request body,
+// shared by every provider that speaks that schema
+type chatCompletionRequest struct {
+	Model       string        `json:"model,omitempty"`
+	Messages    []ChatMessage `json:"messages"`
+	Temperature *float64      `json:"temperature,omitempty"`
+	TopP        *float64      `json:"top_p,omitempty"`
+	MaxTokens   int           `json:"max_tokens,omitempty"`
+	Stop        []string      `json:"stop,omitempty"`
+	Seed        *int64        `json:"seed,omitempty"`
+	Stream      bool          `json:"stream"`
+	StreamOpts  *streamOpts   `json:"stream_options,omitempty"`
+}
+
+// streamOpts asks OpenAI to end a stream with a usage-only frame
+type streamOpts struct {
+	IncludeUsage bool `json:"include_usage"`
+}
 
-			req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonPayload))
+func newChatCompletionRequest(model string, req Request) chatCompletionRequest {
+	return chatCompletionRequest{
+		Model:       model,
+		Messages:    req.Messages,
+		Temperature: req.Options.Temperature,
+		TopP:        req.Options.TopP,
+		MaxTokens:   req.Options.MaxTokens,
+		Stop:        req.Options.Stop,
+		Seed:        req.Options.Seed,
+	}
+}
+
+// streamChatCompletion streams an OpenAI-style chat completion from c.url
+func (c *breakerClient) streamChatCompletion(ctx context.Context, source string, payload chatCompletionRequest) (<-chan StreamEvent, error) {
+	payload.Stream = true
+	body, err := openStream(ctx, source, c.url, c.headers, c.maxRetries, c.retryDelay, c.maxRetryDelay, payload, c.httpClient, c.cb)
+	if err != nil {
+		return nil, err
+	}
+	return pumpStream(ctx, source, body, chatCompletionStream(body)), nil
+}
+
+// callAPI makes HTTP requests with retries and returns the raw response body.
+// Failures are returned as *ProviderError where a status was received;
+// only retryable ones are retried, with exponential backoff and jitter.
+func callAPI(ctx context.Context, source, url string, headers map[string]string, maxRetries uint, retryDelay, maxRetryDelay time.Duration,
+	payload interface{}, httpClient *http.Client, cb *gobreaker.CircuitBreaker) ([]byte, error) {
+	result, err := postWithRetry(ctx, source, url, headers, maxRetries, retryDelay, maxRetryDelay, payload, httpClient, cb, false)
+	if err != nil {
+		return nil, err
+	}
+	return result.([]byte), nil
+}
+
+// openStream is callAPI for streaming endpoints. It retries until the
+// provider accepts the request and returns the open response body; the
+// caller must close it. The client's timeout is dropped because it would
+// cut off long streams; ctx bounds the stream instead.
+func openStream(ctx context.Context, source, url string, headers map[string]string, maxRetries uint, retryDelay, maxRetryDelay time.Duration,
+	payload interface{}, httpClient *http.Client, cb *gobreaker.CircuitBreaker) (io.ReadCloser, error) {
+	streamClient := *httpClient
+	streamClient.Timeout = 0
+	result, err := postWithRetry(ctx, source, url, headers, maxRetries, retryDelay, maxRetryDelay, payload, &streamClient, cb, true)
+	if err != nil {
+		return nil, err
+	}
+	return result.(io.ReadCloser), nil
+}
+
+// postWithRetry POSTs payload as JSON through the circuit breaker, retrying
+// retryable failures. On success it returns the body as []byte, or as the
+// unread io.ReadCloser when stream is set.
+func postWithRetry(ctx context.Context, source, url string, headers map[string]string, maxRetries uint, retryDelay, maxRetryDelay time.Duration,
+	payload interface{}, httpClient *http.Client, cb *gobreaker.CircuitBreaker, stream bool) (interface{}, error) {
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("marshal error: %v", err)
+	}
+
+	var body interface{}
+	err = retry.Do(
+		func() error {
+			req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(jsonPayload))
 			if err != nil {
-				return fmt.Errorf("request error: %v", err)
+				return retry.Unrecoverable(fmt.Errorf("request error: %v", err))
 			}
 			req.Header.Set("Content-Type", "application/json")
-			if apiKey != "" && authType != "" {
-				req.Header.Set("Authorization", fmt.Sprintf("%s %s", authType, apiKey))
+			if stream {
+				req.Header.Set("Accept", "text/event-stream")
+			}
+			for key, value := range headers {
+				req.Header.Set(key, value)
 			}
 
-			// Wrap HTTP request with circuit breaker
-			httpResp, err := cb.Execute(func() (interface{}, error) {
+			// Wrap the whole exchange with the circuit breaker so that 5xx
+			// responses count against the provider, not just transport errors
+			result, err := cb.Execute(func() (interface{}, error) {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
 				resp, err := httpClient.Do(req)
 				if err != nil {
-					return nil, fmt.Errorf("http error: %v", err)
+					if ctx.Err() != nil {
+						return nil, ctx.Err()
+					}
+					return nil, &ProviderError{Provider: source, Message: err.Error(), Retryable: true}
 				}
-				return resp, nil
-			})
-
-			if err != nil {
-				return fmt.Errorf("circuit breaker error: %v", err)
-			}
-
-			respObj := httpResp.(*http.Response)
-			defer respObj.Body.Close()
-
-			if respObj.StatusCode != http.StatusOK {
-				return fmt.Errorf("status %d: %s", respObj.StatusCode, respObj.Status)
-			}
+				if stream && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+					return resp.Body, nil
+				}
+				defer resp.Body.Close()
 
-			var rawContent bytes.Buffer
-			_, err = rawContent.ReadFrom(respObj.Body)
+				var rawContent bytes.Buffer
+				if _, err := rawContent.ReadFrom(resp.Body); err != nil {
+					return nil, &ProviderError{Provider: source, StatusCode: resp.StatusCode, Message: fmt.Sprintf("read error: %v", err), Retryable: true}
+				}
+				if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+					return nil, newStatusError(source, resp, rawContent.Bytes())
+				}
+				return rawContent.Bytes(), nil
+			})
 			if err != nil {
-				return fmt.Errorf("read error: %v", err)
+				if errors.Is(err, gobreaker.ErrOpenState) || errors.Is(err, gobreaker.ErrTooManyRequests) {
+					return fmt.Errorf("circuit breaker error: %w", err)
+				}
+				return err
 			}
 
-			apiResp = ApiResponse{Source: source, Message: rawContent.String()}
+			body = result
 			return nil
 		},
+		retry.Context(ctx),
 		retry.Attempts(maxRetries),
 		retry.Delay(retryDelay),
+		retry.DelayType(backoffDelay(maxRetryDelay)),
 		retry.RetryIf(func(err error) bool {
-			return err != nil && !isPermanentError(err)
+			return err != nil && retry.IsRecoverable(err) && !isPermanentError(err)
 		}),
 	)
 
 	if err != nil {
-		return ApiResponse{Source: source, Error: err.Error()}
+		return nil, err
 	}
-	return apiResp
-}
-
-func isPermanentError(err error) bool {
-	return false
+	return body, nil
 }
@@ -1,8 +1,11 @@
 package facade
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -10,17 +13,97 @@ import (
 
 // Config holds configuration for AI clients and facade
 type Config struct {
-	OpenAIKey      string
-	OpenAIURL      string
-	HuggingFaceKey string
-	HuggingFaceURL string
-	GeminiKey      string
-	GeminiURL      string
+	Providers        []string // Names of the providers NewFacade should build
+	OpenAIKey        string
+	OpenAIURL        string
+	OpenAIModel      string // Default model; requests may override it
+	HuggingFaceKey   string
+	HuggingFaceURL   string
+	HuggingFaceModel string
+	GeminiKey        string
+	GeminiURL        string // Models base URL; the model and :generateContent are appended
+	GeminiModel      string
+
+	AnthropicKey          string
+	AnthropicURL          string
+	AnthropicVersion      string // Value of the anthropic-version header
+	AnthropicModel        string
+	AnthropicMaxTokens    int
+	AnthropicSystemPrompt string
+
+	LocalBaseURL string // Ollama or llama.cpp server, e.g. http://localhost:11434
+	LocalAPI     string // Wire format: "ollama" or "openai"
+	LocalModel   string
+	LocalAPIKey  string        // Optional; most local servers need none
+	LocalTimeout time.Duration // HTTP timeout; local inference is slower than cloud APIs
+
+	OpenAICompatible []OpenAICompatibleConfig // Named endpoints declared via OPENAI_COMPATIBLE
+
+	JudgeProvider string // Provider consulted by the "judge" merge strategy
+	JudgeModel    string // Optional model override for the judge
+
+	QueueBackend   string // "rabbitmq", "memory" or "redis"
 	RABBITMQ_URL   string
 	Redis_URL      string
+	MaxDeliveries  int           // Attempts per queued task before it is dead-lettered
+	ConfirmTimeout time.Duration // How long an enqueue waits for RabbitMQ's confirm
 	Timeout        time.Duration // HTTP client timeout
+	RequestTimeout time.Duration // Overall deadline for one merged request, retries included
 	MaxRetries     uint          // Max retry attempts for API calls
-	RetryDelay     time.Duration // Delay between retries
+	RetryDelay     time.Duration // Base delay for exponential backoff between retries
+	MaxRetryDelay  time.Duration // Cap on a single backoff delay
+
+	WorkerConcurrency int           // Tasks a worker processes at once; also its prefetch
+	ShutdownTimeout   time.Duration // How long a stopping worker waits for in-flight tasks
+
+	ResultStore string        // "redis" or "sql"
+	TaskTTL     time.Duration // Expiry of task records in Redis
+	SQLDriver   string        // "sqlite" or "postgres"
+	SQLDSN      string        // File name or connection string for SQLDriver
+
+	IdempotencyWindow time.Duration // How long an Idempotency-Key maps to its task
+	MaxBodyBytes      int64         // Largest request body the API accepts
+	AuthRequired      bool          // Whether api_server requires a bearer API key
+	CallbackSecret    string        // HMAC key the worker signs task callbacks with
+
+	ProviderLimits map[string]ProviderLimit // Outbound limits by provider name, shared through Redis
+	RateLimit      float64                  // Task submissions per second per API key; 0 disables
+	RateLimitBurst int                      // Submissions an idle API key may make at once
+	TenantQuota    Quota                    // Default daily and monthly submissions per tenant
+	TenantQuotas   map[string]Quota         // Per-tenant overrides of TenantQuota
+
+	Prices map[string]Price // USD per million tokens by model name or prefix
+
+	TenantBudget          Budget            // Default daily and monthly spend per tenant
+	TenantBudgets         map[string]Budget // Per-tenant overrides of TenantBudget
+	GlobalBudget          Budget            // Spend across all tenants
+	BudgetAction          string            // What happens once a budget is used up; see BudgetActions
+	ExpensivePrice        float64           // Output price per million tokens that BudgetSkipExpensive skips
+	BudgetAlertWebhook    string            // URL POSTed when spend crosses an alert threshold
+	BudgetAlertThresholds []int             // Percentages of a budget that raise alerts
+}
+
+// Quota caps a tenant's task submissions per UTC day and month. Zero
+// means unlimited.
+type Quota struct {
+	Daily   int
+	Monthly int
+}
+
+// QuotaFor returns the quota that applies to tenant
+func (c *Config) QuotaFor(tenant string) Quota {
+	if q, ok := c.TenantQuotas[tenant]; ok {
+		return q
+	}
+	return c.TenantQuota
+}
+
+// BudgetFor returns the spend budget that applies to tenant
+func (c *Config) BudgetFor(tenant string) Budget {
+	if b, ok := c.TenantBudgets[tenant]; ok {
+		return b
+	}
+	return c.TenantBudget
 }
 
 // LoadConfig loads configuration from environment variables
@@ -29,22 +112,80 @@ func LoadConfig() (*Config, error) {
 	_ = godotenv.Load() // Ignore error if no .env file
 
 	config := &Config{
-		OpenAIKey:      os.Getenv("OPENAI_API_KEY"),
-		OpenAIURL:      os.Getenv("OPENAI_URL"),
-		HuggingFaceKey: os.Getenv("HUGGINGFACE_API_KEY"),
-		HuggingFaceURL: os.Getenv("HUGGINGFACE_URL"),
-		GeminiKey:      os.Getenv("GEMINI_API_KEY"),
-		GeminiURL:      os.Getenv("GEMINI_URL"),
+		Providers:        parseList(os.Getenv("PROVIDERS")),
+		OpenAIKey:        os.Getenv("OPENAI_API_KEY"),
+		OpenAIURL:        os.Getenv("OPENAI_URL"),
+		OpenAIModel:      os.Getenv("OPENAI_MODEL"),
+		HuggingFaceKey:   os.Getenv("HUGGINGFACE_API_KEY"),
+		HuggingFaceURL:   os.Getenv("HUGGINGFACE_URL"),
+		HuggingFaceModel: os.Getenv("HUGGINGFACE_MODEL"),
+		GeminiKey:        os.Getenv("GEMINI_API_KEY"),
+		GeminiURL:        os.Getenv("GEMINI_URL"),
+		GeminiModel:      os.Getenv("GEMINI_MODEL"),
+
+		AnthropicKey:          os.Getenv("ANTHROPIC_API_KEY"),
+		AnthropicURL:          os.Getenv("ANTHROPIC_URL"),
+		AnthropicVersion:      os.Getenv("ANTHROPIC_VERSION"),
+		AnthropicModel:        os.Getenv("ANTHROPIC_MODEL"),
+		AnthropicMaxTokens:    1024,
+		AnthropicSystemPrompt: os.Getenv("ANTHROPIC_SYSTEM_PROMPT"),
+
+		LocalBaseURL: os.Getenv("LOCAL_BASE_URL"),
+		LocalAPI:     strings.ToLower(os.Getenv("LOCAL_API")),
+		LocalModel:   os.Getenv("LOCAL_MODEL"),
+		LocalAPIKey:  os.Getenv("LOCAL_API_KEY"),
+		LocalTimeout: 120 * time.Second,
+
+		JudgeProvider: strings.ToLower(strings.TrimSpace(os.Getenv("JUDGE_PROVIDER"))),
+		JudgeModel:    os.Getenv("JUDGE_MODEL"),
+
+		QueueBackend:   strings.ToLower(os.Getenv("QUEUE_BACKEND")),
 		RABBITMQ_URL:   os.Getenv("RABBITMQ_URL"),
 		Redis_URL:      os.Getenv("REDIS_URL"),
+		MaxDeliveries:  5,                // Default delivery attempts
+		ConfirmTimeout: 5 * time.Second,  // Default confirm wait
 		Timeout:        10 * time.Second, // Default timeout
+		RequestTimeout: 60 * time.Second, // Default overall deadline
 		MaxRetries:     3,                // Default retries
 		RetryDelay:     1 * time.Second,  // Default delay
+		MaxRetryDelay:  20 * time.Second, // Default backoff cap
+
+		WorkerConcurrency: 4,
+		ShutdownTimeout:   30 * time.Second,
+
+		ResultStore: strings.ToLower(os.Getenv("RESULT_STORE")),
+		TaskTTL:     1 * time.Hour,
+		SQLDriver:   strings.ToLower(os.Getenv("SQL_DRIVER")),
+		SQLDSN:      os.Getenv("SQL_DSN"),
+
+		IdempotencyWindow: 24 * time.Hour,
+		MaxBodyBytes:      1 << 20,
+		AuthRequired:      true,
+		CallbackSecret:    os.Getenv("CALLBACK_SECRET"),
+
+		RateLimit:      5,
+		RateLimitBurst: 20,
 	}
 
-	// Validate required fields
-	if config.OpenAIKey == "" || config.HuggingFaceKey == "" || config.GeminiKey == "" {
-		return nil, fmt.Errorf("missing required API keys")
+	if v := os.Getenv("REQUEST_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid REQUEST_TIMEOUT: %v", err)
+		}
+		config.RequestTimeout = d
+	}
+	endpoints, err := loadOpenAICompatible()
+	if err != nil {
+		return nil, err
+	}
+	config.OpenAICompatible = endpoints
+	// Keys are validated by each provider's constructor, so only the
+	// providers that are actually enabled need credentials.
+	if len(config.Providers) == 0 {
+		config.Providers = []string{"openai", "huggingface", "gemini"}
+		for _, endpoint := range endpoints {
+			config.Providers = append(config.Providers, endpoint.Name)
+		}
 	}
 	if config.OpenAIURL == "" {
 		config.OpenAIURL = "https://api.openai.com/v1/chat/completions"
@@ -52,12 +193,331 @@ func LoadConfig() (*Config, error) {
 	if config.HuggingFaceURL == "" {
 		config.HuggingFaceURL = "https://api-inference.huggingface.co/models/mixtral/mixtral-8x7b"
 	}
+	if config.OpenAIModel == "" {
+		config.OpenAIModel = "gpt-4o-mini"
+	}
+	if config.HuggingFaceModel == "" {
+		config.HuggingFaceModel = "deepseek/deepseek-v3-0324"
+	}
 	if config.GeminiURL == "" {
-		config.GeminiURL = "https://generativelanguage.googleapis.com/v1beta/models/gemini-pro:generateContent"
+		config.GeminiURL = "https://generativelanguage.googleapis.com/v1beta/models"
+	}
+	// Accept the older full-method form, .../models/<model>:generateContent
+	if base, method, ok := strings.Cut(config.GeminiURL, ":generateContent"); ok && method == "" {
+		if i := strings.LastIndex(base, "/"); i >= 0 {
+			if config.GeminiModel == "" {
+				config.GeminiModel = base[i+1:]
+			}
+			config.GeminiURL = base[:i]
+		}
+	}
+	if config.GeminiModel == "" {
+		config.GeminiModel = "gemini-1.5-flash"
+	}
+	if config.AnthropicURL == "" {
+		config.AnthropicURL = "https://api.anthropic.com/v1/messages"
+	}
+	if config.AnthropicVersion == "" {
+		config.AnthropicVersion = "2023-06-01"
+	}
+	if config.AnthropicModel == "" {
+		config.AnthropicModel = "claude-3-5-haiku-latest"
+	}
+	if v := os.Getenv("ANTHROPIC_MAX_TOKENS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid ANTHROPIC_MAX_TOKENS: %q", v)
+		}
+		config.AnthropicMaxTokens = n
+	}
+	if config.LocalBaseURL == "" {
+		config.LocalBaseURL = "http://localhost:11434"
+	}
+	if config.LocalAPI == "" {
+		config.LocalAPI = LocalAPIOllama
+	}
+	if v := os.Getenv("LOCAL_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LOCAL_TIMEOUT: %v", err)
+		}
+		config.LocalTimeout = d
+	}
+	if config.QueueBackend == "" {
+		config.QueueBackend = "rabbitmq"
+	}
+	if v := os.Getenv("MAX_DELIVERIES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid MAX_DELIVERIES: %q", v)
+		}
+		config.MaxDeliveries = n
 	}
-	if config.RABBITMQ_URL == "" || config.Redis_URL == "" {
-		return nil, fmt.Errorf("missing RabbitMQ URL")
+	if v := os.Getenv("PUBLISH_CONFIRM_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PUBLISH_CONFIRM_TIMEOUT: %v", err)
+		}
+		config.ConfirmTimeout = d
+	}
+	if v := os.Getenv("WORKER_CONCURRENCY"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid WORKER_CONCURRENCY: %q", v)
+		}
+		config.WorkerConcurrency = n
+	}
+	if v := os.Getenv("SHUTDOWN_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SHUTDOWN_TIMEOUT: %v", err)
+		}
+		config.ShutdownTimeout = d
+	}
+	if config.ResultStore == "" {
+		config.ResultStore = "redis"
+	}
+	if v := os.Getenv("TASK_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TASK_TTL: %v", err)
+		}
+		config.TaskTTL = d
+	}
+	if config.SQLDriver == "" {
+		config.SQLDriver = "sqlite"
+	}
+	if config.SQLDSN == "" && config.SQLDriver == "sqlite" {
+		config.SQLDSN = "ai_agents.db"
+	}
+	if v := os.Getenv("IDEMPOTENCY_WINDOW"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid IDEMPOTENCY_WINDOW: %q", v)
+		}
+		config.IdempotencyWindow = d
+	}
+	if v := os.Getenv("MAX_BODY_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid MAX_BODY_BYTES: %q", v)
+		}
+		config.MaxBodyBytes = n
+	}
+	if v := os.Getenv("AUTH_REQUIRED"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid AUTH_REQUIRED: %q", v)
+		}
+		config.AuthRequired = b
+	}
+	if err := loadLimits(config); err != nil {
+		return nil, err
+	}
+	if err := loadPrices(config); err != nil {
+		return nil, err
+	}
+	if err := loadBudgets(config); err != nil {
+		return nil, err
 	}
 
 	return config, nil
 }
+
+// RequireBackends checks that the URLs of the services the worker and
+// api_server need are set: Redis always, RabbitMQ when it is the queue
+// backend. Direct CLI runs against local providers need neither.
+func (c *Config) RequireBackends() error {
+	if c.QueueBackend == "rabbitmq" && c.RABBITMQ_URL == "" {
+		return fmt.Errorf("missing RabbitMQ URL")
+	}
+	if c.Redis_URL == "" {
+		return fmt.Errorf("missing Redis URL")
+	}
+	return nil
+}
+
+// loadLimits reads the submission rate limit, tenant quotas and the
+// <NAME>_RPM / <NAME>_TPM limits of each enabled provider and the judge
+func loadLimits(config *Config) error {
+	if v := os.Getenv("RATE_LIMIT"); v != "" {
+		r, err := strconv.ParseFloat(v, 64)
+		if err != nil || r < 0 {
+			return fmt.Errorf("invalid RATE_LIMIT: %q", v)
+		}
+		config.RateLimit = r
+	}
+	if v := os.Getenv("RATE_LIMIT_BURST"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid RATE_LIMIT_BURST: %q", v)
+		}
+		config.RateLimitBurst = n
+	}
+	for _, v := range []struct {
+		key string
+		dst *int
+	}{
+		{"TENANT_DAILY_QUOTA", &config.TenantQuota.Daily},
+		{"TENANT_MONTHLY_QUOTA", &config.TenantQuota.Monthly},
+	} {
+		if s := os.Getenv(v.key); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid %s: %q", v.key, s)
+			}
+			*v.dst = n
+		}
+	}
+	// TENANT_QUOTAS overrides both for named tenants: acme=1000/20000,...
+	for _, item := range strings.Split(os.Getenv("TENANT_QUOTAS"), ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		tenant, limits, ok := strings.Cut(item, "=")
+		daily, monthly, ok2 := strings.Cut(limits, "/")
+		d, err1 := strconv.Atoi(strings.TrimSpace(daily))
+		m, err2 := strconv.Atoi(strings.TrimSpace(monthly))
+		if !ok || !ok2 || err1 != nil || err2 != nil || d < 0 || m < 0 {
+			return fmt.Errorf("invalid TENANT_QUOTAS entry %q, want tenant=daily/monthly", item)
+		}
+		if config.TenantQuotas == nil {
+			config.TenantQuotas = make(map[string]Quota)
+		}
+		config.TenantQuotas[strings.TrimSpace(tenant)] = Quota{Daily: d, Monthly: m}
+	}
+
+	names := config.Providers
+	if config.JudgeProvider != "" {
+		names = append(names[:len(names):len(names)], config.JudgeProvider)
+	}
+	for _, name := range names {
+		var limit ProviderLimit
+		for _, v := range []struct {
+			key string
+			dst *int
+		}{
+			{envPrefix(name) + "RPM", &limit.RPM},
+			{envPrefix(name) + "TPM", &limit.TPM},
+		} {
+			if s := os.Getenv(v.key); s != "" {
+				n, err := strconv.Atoi(s)
+				if err != nil || n < 0 {
+					return fmt.Errorf("invalid %s: %q", v.key, s)
+				}
+				*v.dst = n
+			}
+		}
+		if limit != (ProviderLimit{}) {
+			if config.ProviderLimits == nil {
+				config.ProviderLimits = make(map[string]ProviderLimit)
+			}
+			config.ProviderLimits[name] = limit
+		}
+	}
+	return nil
+}
+
+// loadPrices starts from DefaultPrices and applies PRICES_FILE, a JSON
+// object like {"gpt-4o": {"input": 2.5, "output": 10}}
+func loadPrices(config *Config) error {
+	config.Prices = make(map[string]Price, len(DefaultPrices))
+	for model, p := range DefaultPrices {
+		config.Prices[model] = p
+	}
+	path := os.Getenv("PRICES_FILE")
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read PRICES_FILE: %v", err)
+	}
+	var prices map[string]Price
+	if err := json.Unmarshal(data, &prices); err != nil {
+		return fmt.Errorf("invalid PRICES_FILE: %v", err)
+	}
+	for model, p := range prices {
+		if p.Input < 0 || p.Output < 0 {
+			return fmt.Errorf("invalid PRICES_FILE: negative price for %q", model)
+		}
+		config.Prices[strings.ToLower(model)] = p
+	}
+	return nil
+}
+
+// loadBudgets reads the tenant and global spend budgets, what to do once
+// they are used up and when to alert
+func loadBudgets(config *Config) error {
+	config.BudgetAction = BudgetReject
+	config.ExpensivePrice = 5
+	config.BudgetAlertWebhook = os.Getenv("BUDGET_ALERT_WEBHOOK")
+	config.BudgetAlertThresholds = []int{50, 80, 100}
+
+	for _, v := range []struct {
+		key string
+		dst *float64
+	}{
+		{"TENANT_DAILY_BUDGET", &config.TenantBudget.Daily},
+		{"TENANT_MONTHLY_BUDGET", &config.TenantBudget.Monthly},
+		{"GLOBAL_DAILY_BUDGET", &config.GlobalBudget.Daily},
+		{"GLOBAL_MONTHLY_BUDGET", &config.GlobalBudget.Monthly},
+		{"EXPENSIVE_MODEL_PRICE", &config.ExpensivePrice},
+	} {
+		if s := os.Getenv(v.key); s != "" {
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil || f < 0 {
+				return fmt.Errorf("invalid %s: %q", v.key, s)
+			}
+			*v.dst = f
+		}
+	}
+	// TENANT_BUDGETS overrides both for named tenants: acme=5/100,...
+	for _, item := range strings.Split(os.Getenv("TENANT_BUDGETS"), ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		tenant, limits, ok := strings.Cut(item, "=")
+		daily, monthly, ok2 := strings.Cut(limits, "/")
+		d, err1 := strconv.ParseFloat(strings.TrimSpace(daily), 64)
+		m, err2 := strconv.ParseFloat(strings.TrimSpace(monthly), 64)
+		if !ok || !ok2 || err1 != nil || err2 != nil || d < 0 || m < 0 {
+			return fmt.Errorf("invalid TENANT_BUDGETS entry %q, want tenant=daily/monthly", item)
+		}
+		if config.TenantBudgets == nil {
+			config.TenantBudgets = make(map[string]Budget)
+		}
+		config.TenantBudgets[strings.TrimSpace(tenant)] = Budget{Daily: d, Monthly: m}
+	}
+	if v := os.Getenv("BUDGET_ACTION"); v != "" {
+		config.BudgetAction = strings.ToLower(v)
+		if err := checkBudgetAction(config.BudgetAction); err != nil {
+			return err
+		}
+	}
+	if v := os.Getenv("BUDGET_ALERT_THRESHOLDS"); v != "" {
+		config.BudgetAlertThresholds = nil
+		for _, item := range parseList(v) {
+			n, err := strconv.Atoi(strings.TrimSuffix(item, "%"))
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid BUDGET_ALERT_THRESHOLDS: %q", v)
+			}
+			config.BudgetAlertThresholds = append(config.BudgetAlertThresholds, n)
+		}
+	}
+	return nil
+}
+
+// parseList splits a comma-separated env value into lower-cased, trimmed items
+func parseList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
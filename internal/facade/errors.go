@@ -0,0 +1,188 @@
+package facade
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/avast/retry-go/v4"
+	"github.com/sony/gobreaker"
+)
+
+// ProviderError is a failed call to an upstream provider
+type ProviderError struct {
+	Provider   string
+	StatusCode int           // HTTP status, 0 when no response was received
+	Code       string        // Provider-specific error code or type, if any
+	Message    string        // Provider's error message, or the transport error
+	Retryable  bool          // Whether the same request may succeed if retried
+	RetryAfter time.Duration // Wait requested by the provider via Retry-After
+}
+
+func (e *ProviderError) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Provider)
+	if e.StatusCode != 0 {
+		fmt.Fprintf(&b, ": status %d", e.StatusCode)
+	}
+	if e.Code != "" {
+		fmt.Fprintf(&b, " (%s)", e.Code)
+	}
+	if e.Message != "" {
+		fmt.Fprintf(&b, ": %s", e.Message)
+	}
+	return b.String()
+}
+
+// newStatusError builds a ProviderError from a non-2xx response
+func newStatusError(provider string, resp *http.Response, body []byte) *ProviderError {
+	code, message := parseErrorBody(body)
+	if message == "" {
+		message = http.StatusText(resp.StatusCode)
+	}
+	e := &ProviderError{
+		Provider:   provider,
+		StatusCode: resp.StatusCode,
+		Code:       code,
+		Message:    message,
+		Retryable:  isRetryableStatus(resp.StatusCode),
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		e.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	}
+	return e
+}
+
+// isRetryableStatus reports whether a status may succeed on retry. Client
+// errors fail fast, except request timeouts and rate limiting.
+func isRetryableStatus(status int) bool {
+	switch {
+	case status == http.StatusRequestTimeout, status == http.StatusTooManyRequests:
+		return true
+	case status >= 400 && status < 500:
+		return false
+	default:
+		return true
+	}
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// parseErrorBody extracts an error code and message from the error bodies
+// used by OpenAI ({"error":{"message","type","code"}}), Gemini
+// ({"error":{"code","message","status"}}) and similar APIs.
+func parseErrorBody(body []byte) (code, message string) {
+	var envelope struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil || len(envelope.Error) == 0 {
+		return "", strings.TrimSpace(truncate(string(body), 200))
+	}
+
+	var detail struct {
+		Message string          `json:"message"`
+		Type    string          `json:"type"`
+		Status  string          `json:"status"`
+		Code    json.RawMessage `json:"code"`
+	}
+	if err := json.Unmarshal(envelope.Error, &detail); err != nil {
+		// Some APIs (e.g. HuggingFace) return {"error": "message"}
+		var msg string
+		if json.Unmarshal(envelope.Error, &msg) == nil {
+			return "", msg
+		}
+		return "", ""
+	}
+
+	code = strings.Trim(string(detail.Code), `"`)
+	if code == "" || code == "null" {
+		code = detail.Status
+	}
+	if code == "" {
+		code = detail.Type
+	}
+	return code, detail.Message
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+// isPermanentError reports whether retrying err is pointless
+func isPermanentError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	if errors.Is(err, gobreaker.ErrOpenState) || errors.Is(err, gobreaker.ErrTooManyRequests) {
+		return true
+	}
+	var perr *ProviderError
+	if errors.As(err, &perr) {
+		return !perr.Retryable
+	}
+	return false
+}
+
+// isBreakerSuccess decides what counts against a provider's breaker. Caller
+// cancellations and non-retryable client errors (bad key, bad request) say
+// nothing about provider health, so they do not trip it.
+func isBreakerSuccess(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return true
+	}
+	var perr *ProviderError
+	if errors.As(err, &perr) {
+		return perr.StatusCode != 0 && !perr.Retryable
+	}
+	return false
+}
+
+// backoffDelay is a retry.DelayTypeFunc that honors a provider's Retry-After
+// and otherwise backs off exponentially with jitter. Both are capped at
+// maxDelay, so a provider cannot park a worker for hours.
+func backoffDelay(maxDelay time.Duration) retry.DelayTypeFunc {
+	return func(n uint, err error, config *retry.Config) time.Duration {
+		var perr *ProviderError
+		if errors.As(err, &perr) && perr.RetryAfter > 0 {
+			if maxDelay > 0 && perr.RetryAfter > maxDelay {
+				return maxDelay
+			}
+			return perr.RetryAfter
+		}
+		d := retry.BackOffDelay(n, err, config)
+		if maxDelay > 0 && (d > maxDelay || d <= 0) {
+			d = maxDelay
+		}
+		if d <= 0 {
+			return 0
+		}
+		// Equal jitter: spread retries from many workers across [d/2, d]
+		half := d / 2
+		return half + time.Duration(rand.Int63n(int64(d-half)+1))
+	}
+}
@@ -0,0 +1,127 @@
+package facade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/avast/retry-go/v4"
+	"github.com/sony/gobreaker"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"  ", 0},
+		{"30", 30 * time.Second},
+		{" 5 ", 5 * time.Second},
+		{"0", 0},
+		{"-3", 0},
+		{"soon", 0},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+	} {
+		if got := parseRetryAfter(tc.value, now); got != tc.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestIsRetryableStatus(t *testing.T) {
+	for status, want := range map[int]bool{
+		http.StatusBadRequest:          false,
+		http.StatusUnauthorized:        false,
+		http.StatusForbidden:           false,
+		http.StatusNotFound:            false,
+		http.StatusRequestTimeout:      true,
+		http.StatusTooManyRequests:     true,
+		http.StatusInternalServerError: true,
+		http.StatusBadGateway:          true,
+		http.StatusServiceUnavailable:  true,
+		529:                            true, // Anthropic's overloaded
+	} {
+		if got := isRetryableStatus(status); got != want {
+			t.Errorf("isRetryableStatus(%d) = %v, want %v", status, got, want)
+		}
+	}
+}
+
+func TestNewStatusErrorRetryAfter(t *testing.T) {
+	for _, tc := range []struct {
+		status int
+		want   time.Duration
+	}{
+		{http.StatusTooManyRequests, 12 * time.Second},
+		{http.StatusServiceUnavailable, 12 * time.Second},
+		{http.StatusInternalServerError, 0}, // Retry-After is only honored with 429 and 503
+	} {
+		resp := &http.Response{StatusCode: tc.status, Header: http.Header{"Retry-After": {"12"}}}
+		if got := newStatusError("OpenAI", resp, nil).RetryAfter; got != tc.want {
+			t.Errorf("status %d: RetryAfter = %v, want %v", tc.status, got, tc.want)
+		}
+	}
+}
+
+func TestParseErrorBody(t *testing.T) {
+	for _, tc := range []struct {
+		name, body, code, message string
+	}{
+		{"openai", `{"error":{"message":"Invalid API key","type":"invalid_request_error","code":"invalid_api_key"}}`, "invalid_api_key", "Invalid API key"},
+		{"openai null code", `{"error":{"message":"Slow down","type":"requests","code":null}}`, "requests", "Slow down"},
+		{"gemini", `{"error":{"code":429,"message":"Quota exceeded","status":"RESOURCE_EXHAUSTED"}}`, "429", "Quota exceeded"},
+		{"huggingface", `{"error":"Model is loading"}`, "", "Model is loading"},
+		{"plain text", "upstream connect error\n", "", "upstream connect error"},
+	} {
+		code, message := parseErrorBody([]byte(tc.body))
+		if code != tc.code || message != tc.message {
+			t.Errorf("%s: got (%q, %q), want (%q, %q)", tc.name, code, message, tc.code, tc.message)
+		}
+	}
+}
+
+func TestIsPermanentError(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{context.Canceled, true},
+		{fmt.Errorf("call: %w", context.DeadlineExceeded), true},
+		{gobreaker.ErrOpenState, true},
+		{&ProviderError{StatusCode: 400}, true},
+		{&ProviderError{StatusCode: 503, Retryable: true}, false},
+		{errors.New("connection reset"), false},
+	} {
+		if got := isPermanentError(tc.err); got != tc.want {
+			t.Errorf("isPermanentError(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	config := &retry.Config{}
+	retry.Delay(time.Second)(config)
+	delay := backoffDelay(10 * time.Second)
+
+	if got := delay(1, &ProviderError{RetryAfter: 3 * time.Second}, config); got != 3*time.Second {
+		t.Errorf("Retry-After 3s: delay = %v", got)
+	}
+	if got := delay(1, &ProviderError{RetryAfter: time.Hour}, config); got != 10*time.Second {
+		t.Errorf("Retry-After 1h: delay = %v, want the 10s cap", got)
+	}
+	for n := uint(0); n < 10; n++ {
+		got := delay(n, errors.New("timeout"), config)
+		if got < 0 || got > 10*time.Second {
+			t.Errorf("attempt %d: delay = %v, want within [0, 10s]", n, got)
+		}
+	}
+	if got := delay(20, errors.New("timeout"), config); got < 5*time.Second {
+		t.Errorf("attempt 20: delay = %v, want jittered from the 10s cap", got)
+	}
+}
@@ -1,39 +1,78 @@
 package facade
 
 import (
+	"context"
 	"fmt"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 // Facade provides a unified interface for calling multiple AI APIs
 type Facade struct {
-	clients []AIClient
+	clients        []AIClient
+	requestTimeout time.Duration // Overall deadline for one GetMergedResults call
+	judgeClient    AIClient      // Model consulted by StrategyJudge; nil if not configured
+	judgeModel     string
+	prices         map[string]Price  // Price table for Restrict
+	models         map[string]string // Default model by lower-cased Source()
 }
 
-// NewFacade initializes the Facade with AI clients from config
-func NewFacade(cfg *Config) *Facade {
-	return &Facade{
-		clients: []AIClient{
-			NewOpenAIClient(cfg),
-			NewHuggingFaceClient(cfg),
-			NewGeminiClient(cfg),
-		},
+// NewFacade initializes the Facade with the AI clients enabled in config
+func NewFacade(cfg *Config) (*Facade, error) {
+	clients, err := buildClients(cfg)
+	if err != nil {
+		return nil, err
 	}
+	f := &Facade{clients: clients, requestTimeout: cfg.RequestTimeout, judgeModel: cfg.JudgeModel,
+		prices: cfg.Prices, models: make(map[string]string)}
+	for i, c := range clients {
+		f.models[strings.ToLower(c.Source())] = defaultModel(c)
+		clients[i] = &meteredClient{AIClient: c, prices: cfg.Prices, model: defaultModel(c)}
+	}
+	if cfg.JudgeProvider != "" {
+		judge, err := buildClient(cfg, cfg.JudgeProvider)
+		if err != nil {
+			return nil, fmt.Errorf("judge: %v", err)
+		}
+		f.judgeClient = &meteredClient{AIClient: judge, prices: cfg.Prices, model: defaultModel(judge)}
+	}
+	return f, nil
 }
 
 // GetMergedResults calls all AI APIs concurrently and merges results
-func (f *Facade) GetMergedResults(prompt string) MergedApiResponse {
+// using the request's merge strategy. Strategies that can decide early
+// cancel the providers still running; their results are left out of the
+// merge, but answers that arrive anyway are kept in Late and billed.
+// Cancelling ctx, or hitting the facade's request timeout, stops every
+// in-flight provider call; those providers report the context error.
+func (f *Facade) GetMergedResults(ctx context.Context, req Request) MergedApiResponse {
+	return f.GetMergedResultsWithProgress(ctx, req, nil)
+}
+
+// GetMergedResultsWithProgress is GetMergedResults, calling onResult (if
+// not nil) with each provider's response as soon as it arrives
+func (f *Facade) GetMergedResultsWithProgress(ctx context.Context, req Request, onResult func(ApiResponse)) MergedApiResponse {
+	if f.requestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.requestTimeout)
+		defer cancel()
+	}
+	callCtx, cancelCalls := context.WithCancel(ctx)
+	defer cancelCalls()
+
+	clients := f.clientsFor(req)
 	var wg sync.WaitGroup
-	resultsChan := make(chan ApiResponse, len(f.clients))
+	resultsChan := make(chan ApiResponse, len(clients))
 
 	// Fork: Launch goroutines for each API call
-	for _, client := range f.clients {
+	for _, client := range clients {
 		wg.Add(1)
 		go func(c AIClient) {
 			defer wg.Done()
-			resultsChan <- c.Call(prompt)
+			resultsChan <- c.Call(callCtx, req)
 		}(client)
 	}
 
@@ -43,13 +82,59 @@ func (f *Facade) GetMergedResults(prompt string) MergedApiResponse {
 		close(resultsChan)
 	}()
 
-	// Collect results
+	// Collect results until every provider answered or the strategy is satisfied
 	var results []ApiResponse
 	for resp := range resultsChan {
 		results = append(results, resp)
+		if onResult != nil {
+			onResult(resp)
+		}
+		if req.Merge.enough(results, len(clients)) {
+			cancelCalls()
+			break
+		}
+	}
+
+	// Calls still running were cancelled, but some providers answer (and
+	// bill) anyway; those answers are kept out of the merge but counted
+	var late []ApiResponse
+	for resp := range resultsChan {
+		if resp.Usage != nil || resp.Error == "" {
+			late = append(late, resp)
+		}
+	}
+
+	merged := MergedApiResponse{Results: results, Late: late}
+	f.merge(ctx, req, &merged)
+	merged.Usage = merged.TotalUsage()
+	return merged
+}
+
+// clientsFor returns the clients named in req.Providers, or every client
+// when it is empty
+func (f *Facade) clientsFor(req Request) []AIClient {
+	if len(req.Providers) == 0 {
+		return f.clients
+	}
+	var clients []AIClient
+	for _, c := range f.clients {
+		for _, name := range req.Providers {
+			if strings.EqualFold(name, c.Source()) {
+				clients = append(clients, c)
+				break
+			}
+		}
 	}
+	return clients
+}
 
-	return MergedApiResponse{Results: results}
+// Merge applies the request's merge strategy to results that were
+// collected elsewhere, e.g. from the Done events of Stream
+func (f *Facade) Merge(ctx context.Context, req Request, results []ApiResponse) MergedApiResponse {
+	merged := MergedApiResponse{Results: results}
+	f.merge(ctx, req, &merged)
+	merged.Usage = merged.TotalUsage()
+	return merged
 }
 
 // Handler is the gin-compatible handler
@@ -60,7 +145,16 @@ func (f *Facade) Handler(c *gin.Context) {
 		return
 	}
 
-	result := f.GetMergedResults(prompt)
+	req := Request{
+		Messages: PromptMessages(c.Query("system"), prompt),
+		Merge:    MergeOptions{Strategy: c.Query("strategy")},
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := f.GetMergedResults(c.Request.Context(), req)
 	for _, r := range result.Results {
 		if r.Error != "" {
 			c.JSON(500, gin.H{"error": fmt.Sprintf("%s failed: %v", r.Source, r.Error)})
@@ -0,0 +1,70 @@
+package facade
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// fakeClient answers with resp after delay. With billCancelled set it
+// still answers, with usage, when its context is cancelled, as a provider
+// that had already produced its reply would.
+type fakeClient struct {
+	resp          ApiResponse
+	delay         time.Duration
+	billCancelled bool
+}
+
+func (c *fakeClient) Source() string { return c.resp.Source }
+
+func (c *fakeClient) Call(ctx context.Context, req Request) ApiResponse {
+	select {
+	case <-time.After(c.delay):
+		return c.resp
+	case <-ctx.Done():
+		if c.billCancelled {
+			return c.resp
+		}
+		return ApiResponse{Source: c.resp.Source, Error: ctx.Err().Error()}
+	}
+}
+
+func TestGetMergedResultsStopsWhenEnough(t *testing.T) {
+	f := &Facade{clients: []AIClient{
+		&fakeClient{resp: ApiResponse{Source: "Fast", Message: "hi"}},
+		&fakeClient{resp: ApiResponse{Source: "Slow", Message: "hello"}, delay: time.Minute},
+	}}
+	req := Request{Messages: PromptMessages("", "hi"), Merge: MergeOptions{Strategy: StrategyFirstSuccessful}}
+
+	start := time.Now()
+	merged := f.GetMergedResults(context.Background(), req)
+
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("took %v, want the slow call cancelled", elapsed)
+	}
+	if len(merged.Results) != 1 || merged.Output != "hi" {
+		t.Fatalf("merged %+v, want only Fast's answer", merged)
+	}
+}
+
+func TestGetMergedResultsCountsLateUsage(t *testing.T) {
+	f := &Facade{clients: []AIClient{
+		&fakeClient{resp: ApiResponse{Source: "Fast", Message: "hi", Usage: &Usage{InputTokens: 10, OutputTokens: 5, Cost: 0.25}}},
+		&fakeClient{resp: ApiResponse{Source: "Slow", Message: "hello", Usage: &Usage{InputTokens: 20, OutputTokens: 7, Cost: 0.5}}, delay: time.Minute, billCancelled: true},
+		&fakeClient{resp: ApiResponse{Source: "Free", Message: "hey"}, delay: time.Minute},
+	}}
+	req := Request{Messages: PromptMessages("", "hi"), Merge: MergeOptions{Strategy: StrategyFirstSuccessful}}
+
+	merged := f.GetMergedResults(context.Background(), req)
+
+	if len(merged.Results) != 1 || merged.Output != "hi" {
+		t.Fatalf("merged %+v, want only Fast's answer", merged.Results)
+	}
+	if len(merged.Late) != 1 || merged.Late[0].Source != "Slow" {
+		t.Fatalf("Late = %+v, want Slow's billed answer only", merged.Late)
+	}
+	want := Usage{InputTokens: 30, OutputTokens: 12, Cost: 0.75}
+	if merged.Usage != want {
+		t.Fatalf("Usage = %+v, want %+v", merged.Usage, want)
+	}
+}
@@ -0,0 +1,70 @@
+package facade
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Limiter admits outbound provider calls under limits that may be shared
+// by every process calling the same provider
+type Limiter interface {
+	// Wait blocks until provider may be sent one request of about tokens
+	// tokens, or ctx is done
+	Wait(ctx context.Context, provider string, tokens int) error
+}
+
+// ProviderLimit caps one provider's outbound traffic. Zero means unlimited.
+type ProviderLimit struct {
+	RPM int // Requests per minute
+	TPM int // Tokens per minute, counting the prompt estimate plus max_tokens
+}
+
+// SetLimiter makes every client, the judge included, wait on l before
+// each call to its provider. Providers are named by lower-cased Source().
+func (f *Facade) SetLimiter(l Limiter) {
+	for i, c := range f.clients {
+		f.clients[i] = &limitedClient{AIClient: c, limiter: l}
+	}
+	if f.judgeClient != nil {
+		f.judgeClient = &limitedClient{AIClient: f.judgeClient, limiter: l}
+	}
+}
+
+// limitedClient is an AIClient that waits on a Limiter before each call
+type limitedClient struct {
+	AIClient
+	limiter Limiter
+}
+
+func (c *limitedClient) Call(ctx context.Context, req Request) ApiResponse {
+	if err := c.wait(ctx, req); err != nil {
+		return ApiResponse{Source: c.Source(), Error: err.Error()}
+	}
+	return c.AIClient.Call(ctx, req)
+}
+
+// Stream streams the wrapped client, which need not be a Streamer
+func (c *limitedClient) Stream(ctx context.Context, req Request) (<-chan StreamEvent, error) {
+	if err := c.wait(ctx, req); err != nil {
+		return nil, err
+	}
+	return streamClient(ctx, c.AIClient, req), nil
+}
+
+func (c *limitedClient) wait(ctx context.Context, req Request) error {
+	if err := c.limiter.Wait(ctx, strings.ToLower(c.Source()), estimateTokens(req)); err != nil {
+		return fmt.Errorf("rate limit: %v", err)
+	}
+	return nil
+}
+
+// estimateTokens guesses the tokens a request will use before it is sent:
+// roughly four characters per prompt token, plus the completion budget
+func estimateTokens(req Request) int {
+	tokens := req.Options.MaxTokens
+	for _, m := range req.Messages {
+		tokens += len(m.Content)/4 + 4 // Per-message overhead
+	}
+	return tokens
+}
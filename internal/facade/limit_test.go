@@ -0,0 +1,76 @@
+package facade
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// recordingLimiter records each Wait and fails them all with err, if set
+type recordingLimiter struct {
+	waits []string
+	asked []int
+	err   error
+}
+
+func (l *recordingLimiter) Wait(ctx context.Context, provider string, tokens int) error {
+	l.waits = append(l.waits, provider)
+	l.asked = append(l.asked, tokens)
+	return l.err
+}
+
+func TestEstimateTokens(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		req  Request
+		want int
+	}{
+		{name: "empty", want: 0},
+		{name: "one message", req: Request{Messages: PromptMessages("", "0123456789abcdef")}, want: 16/4 + 4},
+		{name: "short messages still count overhead", req: Request{Messages: PromptMessages("Be", "hi")}, want: 2 * 4},
+		{name: "with completion budget", req: Request{
+			Messages: PromptMessages("", "0123456789abcdef"),
+			Options:  GenerationOptions{MaxTokens: 100},
+		}, want: 100 + 16/4 + 4},
+	} {
+		if got := estimateTokens(tc.req); got != tc.want {
+			t.Errorf("%s: estimateTokens = %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestSetLimiter(t *testing.T) {
+	limiter := &recordingLimiter{}
+	f := &Facade{
+		clients:     []AIClient{&fakeClient{resp: ApiResponse{Source: "OpenAI", Message: "hi"}}},
+		judgeClient: &fakeClient{resp: ApiResponse{Source: "Anthropic", Message: "verdict"}},
+	}
+	f.SetLimiter(limiter)
+	req := Request{Messages: PromptMessages("", "0123456789abcdef"), Options: GenerationOptions{MaxTokens: 50}}
+
+	if resp := f.clients[0].Call(context.Background(), req); resp.Message != "hi" {
+		t.Errorf("Call = %+v", resp)
+	}
+	if resp := f.judgeClient.Call(context.Background(), req); resp.Message != "verdict" {
+		t.Errorf("judge Call = %+v", resp)
+	}
+	want := 50 + 16/4 + 4
+	if !reflect.DeepEqual(limiter.waits, []string{"openai", "anthropic"}) || !reflect.DeepEqual(limiter.asked, []int{want, want}) {
+		t.Errorf("waits = %v for %v tokens, want openai and anthropic for %d", limiter.waits, limiter.asked, want)
+	}
+}
+
+func TestLimitedClientRefused(t *testing.T) {
+	limiter := &recordingLimiter{err: context.DeadlineExceeded}
+	f := &Facade{clients: []AIClient{&fakeClient{resp: ApiResponse{Source: "OpenAI", Message: "hi"}}}}
+	f.SetLimiter(limiter)
+	req := Request{Messages: PromptMessages("", "hi")}
+
+	resp := f.clients[0].Call(context.Background(), req)
+	if resp.Message != "" || resp.Error != "rate limit: "+context.DeadlineExceeded.Error() || resp.Source != "OpenAI" {
+		t.Errorf("Call = %+v", resp)
+	}
+	if _, err := f.clients[0].(Streamer).Stream(context.Background(), req); err == nil || err.Error() != resp.Error {
+		t.Errorf("Stream err = %v, want %q", err, resp.Error)
+	}
+}
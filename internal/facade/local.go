@@ -0,0 +1,199 @@
+package facade
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+func init() {
+	Register("local", func(cfg *Config) (AIClient, error) {
+		if cfg.LocalBaseURL == "" || cfg.LocalModel == "" {
+			return nil, fmt.Errorf("missing LOCAL_BASE_URL or LOCAL_MODEL")
+		}
+		switch cfg.LocalAPI {
+		case LocalAPIOllama, LocalAPIOpenAI:
+		default:
+			return nil, fmt.Errorf("unsupported LOCAL_API %q (want %s or %s)", cfg.LocalAPI, LocalAPIOllama, LocalAPIOpenAI)
+		}
+		return NewLocalClient(cfg), nil
+	})
+}
+
+// Wire formats understood by LocalClient
+const (
+	LocalAPIOllama = "ollama" // Ollama native /api/chat
+	LocalAPIOpenAI = "openai" // OpenAI-compatible /v1/chat/completions (llama.cpp server, Ollama, LM Studio)
+)
+
+// LocalClient implements AIClient for a self-hosted model server such as
+// Ollama or the llama.cpp server. No API key is required.
+type LocalClient struct {
+	breakerClient
+	api string
+}
+
+func NewLocalClient(cfg *Config) *LocalClient {
+	base := strings.TrimRight(cfg.LocalBaseURL, "/")
+	url := base + "/api/chat"
+	if cfg.LocalAPI == LocalAPIOpenAI {
+		url = base + "/v1/chat/completions"
+	}
+	headers := map[string]string{}
+	if cfg.LocalAPIKey != "" {
+		headers["Authorization"] = "Bearer " + cfg.LocalAPIKey
+	}
+	return &LocalClient{
+		breakerClient: breakerClient{
+			httpClient:    &http.Client{Timeout: cfg.LocalTimeout},
+			apiKey:        cfg.LocalAPIKey,
+			url:           url,
+			headers:       headers,
+			model:         cfg.LocalModel,
+			maxRetries:    cfg.MaxRetries,
+			retryDelay:    cfg.RetryDelay,
+			maxRetryDelay: cfg.MaxRetryDelay,
+			cb:            newBreaker("Local"),
+		},
+		api: cfg.LocalAPI,
+	}
+}
+
+// ollamaChatResponse is the non-streaming /api/chat response body
+type ollamaChatResponse struct {
+	Message struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	} `json:"message"`
+	Done            bool   `json:"done"`
+	DoneReason      string `json:"done_reason"`
+	Model           string `json:"model"`
+	PromptEvalCount int    `json:"prompt_eval_count"`
+	EvalCount       int    `json:"eval_count"`
+	Error           string `json:"error"`
+}
+
+// usage returns the token counts Ollama reports once a reply is done
+func (r *ollamaChatResponse) usage() *Usage {
+	if !r.Done {
+		return nil
+	}
+	return &Usage{InputTokens: r.PromptEvalCount, OutputTokens: r.EvalCount}
+}
+
+// ollamaChatRequest is the /api/chat request body
+type ollamaChatRequest struct {
+	Model    string         `json:"model"`
+	Messages []ChatMessage  `json:"messages"`
+	Options  *ollamaOptions `json:"options,omitempty"`
+	Stream   bool           `json:"stream"`
+}
+
+type ollamaOptions struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	NumPredict  int      `json:"num_predict,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+	Seed        *int64   `json:"seed,omitempty"`
+}
+
+func (c *LocalClient) Call(ctx context.Context, req Request) ApiResponse {
+	model := req.Options.ModelFor(c.Source(), c.model)
+	var payload interface{} = newChatCompletionRequest(model, req)
+	if c.api == LocalAPIOllama {
+		payload = newOllamaChatRequest(model, req)
+	}
+	body, err := callAPI(ctx, c.Source(), c.url, c.headers, c.maxRetries, c.retryDelay, c.maxRetryDelay, payload, c.httpClient, c.cb)
+	if err != nil {
+		return ApiResponse{Source: c.Source(), Error: err.Error()}
+	}
+	if c.api == LocalAPIOpenAI {
+		return decodeChatCompletion(c.Source(), body)
+	}
+	return decodeOllamaChat(c.Source(), body)
+}
+
+// Stream implements Streamer. Ollama streams newline-delimited JSON,
+// OpenAI-compatible servers stream SSE.
+func (c *LocalClient) Stream(ctx context.Context, req Request) (<-chan StreamEvent, error) {
+	model := req.Options.ModelFor(c.Source(), c.model)
+	if c.api == LocalAPIOpenAI {
+		return c.streamChatCompletion(ctx, c.Source(), newChatCompletionRequest(model, req))
+	}
+	payload := newOllamaChatRequest(model, req)
+	payload.Stream = true
+	body, err := openStream(ctx, c.Source(), c.url, c.headers, c.maxRetries, c.retryDelay, c.maxRetryDelay, payload, c.httpClient, c.cb)
+	if err != nil {
+		return nil, err
+	}
+	return pumpStream(ctx, c.Source(), body, ollamaStream(body)), nil
+}
+
+func (c *LocalClient) Source() string {
+	return "Local"
+}
+
+func newOllamaChatRequest(model string, req Request) ollamaChatRequest {
+	payload := ollamaChatRequest{
+		Model:    model,
+		Messages: req.Messages,
+	}
+	if opts := req.Options; opts.Temperature != nil || opts.TopP != nil || opts.MaxTokens > 0 || len(opts.Stop) > 0 || opts.Seed != nil {
+		payload.Options = &ollamaOptions{
+			Temperature: opts.Temperature,
+			TopP:        opts.TopP,
+			NumPredict:  opts.MaxTokens,
+			Stop:        opts.Stop,
+			Seed:        opts.Seed,
+		}
+	}
+	return payload
+}
+
+// decodeOllamaChat turns an Ollama /api/chat body into an ApiResponse
+func decodeOllamaChat(source string, body []byte) ApiResponse {
+	var result ollamaChatResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return ApiResponse{Source: source, Error: fmt.Sprintf("decode error: %v", err)}
+	}
+	if result.Error != "" {
+		return ApiResponse{Source: source, Error: fmt.Sprintf("provider error: %s", result.Error)}
+	}
+	return ApiResponse{
+		Source:       source,
+		Message:      result.Message.Content,
+		FinishReason: result.DoneReason,
+		Model:        result.Model,
+		Usage:        result.usage(),
+	}
+}
+
+// ollamaStream decodes Ollama's newline-delimited JSON chat stream
+func ollamaStream(body io.Reader) func() (streamChunk, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return func() (streamChunk, error) {
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			if len(line) == 0 {
+				continue
+			}
+			var frame ollamaChatResponse
+			if err := json.Unmarshal(line, &frame); err != nil {
+				return streamChunk{}, fmt.Errorf("decode error: %v", err)
+			}
+			if frame.Error != "" {
+				return streamChunk{}, fmt.Errorf("provider error: %s", frame.Error)
+			}
+			return streamChunk{Delta: frame.Message.Content, FinishReason: frame.DoneReason, Model: frame.Model, Usage: frame.usage(), Done: frame.Done}, nil
+		}
+		if err := scanner.Err(); err != nil {
+			return streamChunk{}, err
+		}
+		return streamChunk{}, io.EOF
+	}
+}
@@ -0,0 +1,196 @@
+package facade
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Auth styles for OpenAI-compatible endpoints
+const (
+	AuthBearer = "bearer"  // Authorization: Bearer <key> (OpenAI, Groq, Together, OpenRouter, vLLM)
+	AuthAPIKey = "api-key" // api-key: <key> (Azure OpenAI)
+	AuthNone   = "none"    // No auth header
+)
+
+// OpenAICompatibleConfig declares one named chat-completions endpoint.
+// It is read from env vars prefixed with the upper-cased name, e.g. for
+// "groq": GROQ_BASE_URL, GROQ_API_KEY, GROQ_MODEL, GROQ_AUTH, GROQ_HEADERS.
+type OpenAICompatibleConfig struct {
+	Name    string
+	URL     string // Full chat-completions URL
+	APIKey  string
+	Auth    string            // AuthBearer, AuthAPIKey, AuthNone or "header:<Name>"
+	Model   string            // Sent as "model"; may be empty for Azure deployments
+	Headers map[string]string // Extra request headers
+	Breaker BreakerSettings
+}
+
+// OpenAICompatibleClient implements AIClient for any endpoint that speaks
+// the OpenAI chat-completions schema
+type OpenAICompatibleClient struct {
+	breakerClient
+	name string
+}
+
+func NewOpenAICompatibleClient(cfg *Config, endpoint OpenAICompatibleConfig) (*OpenAICompatibleClient, error) {
+	if endpoint.URL == "" {
+		return nil, fmt.Errorf("missing base URL")
+	}
+	headers := make(map[string]string, len(endpoint.Headers)+1)
+	for key, value := range endpoint.Headers {
+		headers[key] = value
+	}
+	switch auth := endpoint.Auth; {
+	case auth == AuthNone:
+	case endpoint.APIKey == "":
+		return nil, fmt.Errorf("missing API key for auth style %q", auth)
+	case auth == AuthBearer:
+		headers["Authorization"] = "Bearer " + endpoint.APIKey
+	case auth == AuthAPIKey:
+		headers["api-key"] = endpoint.APIKey
+	case strings.HasPrefix(auth, "header:") && len(auth) > len("header:"):
+		headers[strings.TrimPrefix(auth, "header:")] = endpoint.APIKey
+	default:
+		return nil, fmt.Errorf("unsupported auth style %q", auth)
+	}
+
+	return &OpenAICompatibleClient{
+		breakerClient: breakerClient{
+			httpClient:    &http.Client{Timeout: cfg.Timeout},
+			apiKey:        endpoint.APIKey,
+			url:           endpoint.URL,
+			headers:       headers,
+			model:         endpoint.Model,
+			maxRetries:    cfg.MaxRetries,
+			retryDelay:    cfg.RetryDelay,
+			maxRetryDelay: cfg.MaxRetryDelay,
+			cb:            newBreakerWith(endpoint.Name, endpoint.Breaker),
+		},
+		name: endpoint.Name,
+	}, nil
+}
+
+func (c *OpenAICompatibleClient) Call(ctx context.Context, req Request) ApiResponse {
+	payload := newChatCompletionRequest(req.Options.ModelFor(c.Source(), c.model), req)
+	body, err := callAPI(ctx, c.Source(), c.url, c.headers, c.maxRetries, c.retryDelay, c.maxRetryDelay, payload, c.httpClient, c.cb)
+	if err != nil {
+		return ApiResponse{Source: c.Source(), Error: err.Error()}
+	}
+	return decodeChatCompletion(c.Source(), body)
+}
+
+// Stream implements Streamer
+func (c *OpenAICompatibleClient) Stream(ctx context.Context, req Request) (<-chan StreamEvent, error) {
+	return c.streamChatCompletion(ctx, c.Source(), newChatCompletionRequest(req.Options.ModelFor(c.Source(), c.model), req))
+}
+
+func (c *OpenAICompatibleClient) Source() string {
+	return c.name
+}
+
+// findOpenAICompatible looks up a declared endpoint by name
+func (c *Config) findOpenAICompatible(name string) (OpenAICompatibleConfig, bool) {
+	for _, endpoint := range c.OpenAICompatible {
+		if endpoint.Name == name {
+			return endpoint, true
+		}
+	}
+	return OpenAICompatibleConfig{}, false
+}
+
+// loadOpenAICompatible reads the endpoints named in OPENAI_COMPATIBLE
+func loadOpenAICompatible() ([]OpenAICompatibleConfig, error) {
+	var endpoints []OpenAICompatibleConfig
+	for _, name := range parseList(os.Getenv("OPENAI_COMPATIBLE")) {
+		prefix := envPrefix(name)
+		endpoint := OpenAICompatibleConfig{
+			Name:    name,
+			URL:     os.Getenv(prefix + "URL"),
+			APIKey:  os.Getenv(prefix + "API_KEY"),
+			Auth:    strings.ToLower(os.Getenv(prefix + "AUTH")),
+			Model:   os.Getenv(prefix + "MODEL"),
+			Headers: parseHeaders(os.Getenv(prefix + "HEADERS")),
+			Breaker: DefaultBreakerSettings,
+		}
+		if endpoint.URL == "" {
+			if base := os.Getenv(prefix + "BASE_URL"); base != "" {
+				endpoint.URL = strings.TrimRight(base, "/") + "/chat/completions"
+			}
+		}
+		if endpoint.Auth == "" {
+			endpoint.Auth = AuthBearer
+		}
+		if err := loadBreakerSettings(prefix, &endpoint.Breaker); err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	return endpoints, nil
+}
+
+// loadBreakerSettings overrides breaker settings from <prefix>BREAKER_* vars
+func loadBreakerSettings(prefix string, st *BreakerSettings) error {
+	for _, d := range []struct {
+		key string
+		dst *time.Duration
+	}{
+		{"BREAKER_INTERVAL", &st.Interval},
+		{"BREAKER_TIMEOUT", &st.Timeout},
+	} {
+		if v := os.Getenv(prefix + d.key); v != "" {
+			parsed, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("invalid %s%s: %v", prefix, d.key, err)
+			}
+			*d.dst = parsed
+		}
+	}
+	for _, n := range []struct {
+		key string
+		dst *uint32
+	}{
+		{"BREAKER_MAX_REQUESTS", &st.MaxRequests},
+		{"BREAKER_MAX_FAILURES", &st.MaxFailures},
+	} {
+		if v := os.Getenv(prefix + n.key); v != "" {
+			parsed, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				return fmt.Errorf("invalid %s%s: %v", prefix, n.key, err)
+			}
+			*n.dst = uint32(parsed)
+		}
+	}
+	return nil
+}
+
+// envPrefix turns an endpoint name like "open-router" into "OPEN_ROUTER_"
+func envPrefix(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, name) + "_"
+}
+
+// parseHeaders parses "Name: value; Other: value" into a header map
+func parseHeaders(value string) map[string]string {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(value, ";") {
+		key, val, ok := strings.Cut(pair, ":")
+		if !ok || strings.TrimSpace(key) == "" {
+			continue
+		}
+		headers[strings.TrimSpace(key)] = strings.TrimSpace(val)
+	}
+	return headers
+}
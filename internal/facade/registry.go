@@ -0,0 +1,87 @@
+package facade
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ProviderConstructor builds an AIClient from config. It returns an error
+// when the provider is enabled but not usable, e.g. its API key is missing.
+type ProviderConstructor func(cfg *Config) (AIClient, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]ProviderConstructor)
+)
+
+// Register makes a provider available to NewFacade under the given name.
+// It panics if the name is empty or already registered.
+func Register(name string, ctor ProviderConstructor) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if name == "" || ctor == nil {
+		panic("facade: Register called with empty name or nil constructor")
+	}
+	if _, dup := registry[name]; dup {
+		panic("facade: Register called twice for provider " + name)
+	}
+	registry[name] = ctor
+}
+
+// Providers returns the sorted names of all registered providers
+func Providers() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return providerNamesLocked()
+}
+
+// buildClients constructs the clients for every provider enabled in config
+func buildClients(cfg *Config) ([]AIClient, error) {
+	if len(cfg.Providers) == 0 {
+		return nil, fmt.Errorf("no providers enabled")
+	}
+	clients := make([]AIClient, 0, len(cfg.Providers))
+	for _, name := range cfg.Providers {
+		client, err := buildClient(cfg, name)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+	return clients, nil
+}
+
+// buildClient constructs one provider, registered or declared in config
+func buildClient(cfg *Config, name string) (AIClient, error) {
+	registryMu.RLock()
+	ctor, ok := registry[name]
+	registered := providerNamesLocked()
+	registryMu.RUnlock()
+
+	endpoint, declared := cfg.findOpenAICompatible(name)
+	switch {
+	case ok && declared:
+		return nil, fmt.Errorf("OpenAI-compatible endpoint %q conflicts with a registered provider", name)
+	case declared:
+		ctor = func(*Config) (AIClient, error) { return NewOpenAICompatibleClient(cfg, endpoint) }
+	case !ok:
+		return nil, fmt.Errorf("unknown provider %q (registered: %s)", name, strings.Join(registered, ", "))
+	}
+	client, err := ctor(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("provider %s: %v", name, err)
+	}
+	return client, nil
+}
+
+func providerNamesLocked() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
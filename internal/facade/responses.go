@@ -0,0 +1,179 @@
+package facade
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// providerErrorBody is the error envelope returned by OpenAI-style APIs,
+// sometimes alongside a 200 status.
+type providerErrorBody struct {
+	Message string          `json:"message"`
+	Type    string          `json:"type"`
+	Code    json.RawMessage `json:"code"`
+}
+
+// chatCompletionResponse is the OpenAI chat-completions response body
+type chatCompletionResponse struct {
+	Choices []struct {
+		Message struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Model string               `json:"model"`
+	Usage *chatCompletionUsage `json:"usage"`
+	Error *providerErrorBody   `json:"error"`
+}
+
+// chatCompletionUsage is the token usage reported by OpenAI-style APIs
+type chatCompletionUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+func (u *chatCompletionUsage) toUsage() *Usage {
+	if u == nil {
+		return nil
+	}
+	return &Usage{InputTokens: u.PromptTokens, OutputTokens: u.CompletionTokens}
+}
+
+// geminiSafetyRating is one entry of Gemini's safetyRatings
+type geminiSafetyRating struct {
+	Category    string `json:"category"`
+	Probability string `json:"probability"`
+	Blocked     bool   `json:"blocked"`
+}
+
+// geminiResponse is the Gemini generateContent response body
+type geminiResponse struct {
+	Candidates []struct {
+		Content struct {
+			Role  string `json:"role"`
+			Parts []struct {
+				Text string `json:"text"`
+			} `json:"parts"`
+		} `json:"content"`
+		FinishReason  string               `json:"finishReason"`
+		SafetyRatings []geminiSafetyRating `json:"safetyRatings"`
+	} `json:"candidates"`
+	PromptFeedback *struct {
+		BlockReason   string               `json:"blockReason"`
+		SafetyRatings []geminiSafetyRating `json:"safetyRatings"`
+	} `json:"promptFeedback"`
+	UsageMetadata *struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+	} `json:"usageMetadata"`
+	ModelVersion string `json:"modelVersion"`
+	Error        *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
+
+// geminiBlockedFinishReasons are finish reasons that mean the answer was withheld
+var geminiBlockedFinishReasons = map[string]bool{
+	"SAFETY":             true,
+	"RECITATION":         true,
+	"BLOCKLIST":          true,
+	"PROHIBITED_CONTENT": true,
+	"SPII":               true,
+}
+
+// decodeChatCompletion turns an OpenAI-style chat-completions body into an ApiResponse
+func decodeChatCompletion(source string, body []byte) ApiResponse {
+	var result chatCompletionResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return ApiResponse{Source: source, Error: fmt.Sprintf("decode error: %v", err)}
+	}
+	if result.Error != nil {
+		return ApiResponse{Source: source, Error: fmt.Sprintf("provider error: %s", result.Error.Message)}
+	}
+	if len(result.Choices) == 0 {
+		return ApiResponse{Source: source, Error: "no choices in response"}
+	}
+
+	choice := result.Choices[0]
+	resp := ApiResponse{
+		Source:       source,
+		Message:      choice.Message.Content,
+		FinishReason: choice.FinishReason,
+		Model:        result.Model,
+		Usage:        result.Usage.toUsage(),
+	}
+	if choice.FinishReason == "content_filter" {
+		resp.Safety = &SafetyBlock{Reason: choice.FinishReason}
+		if resp.Message == "" {
+			resp.Error = "response blocked by content filter"
+		}
+	}
+	return resp
+}
+
+// decodeGemini turns a Gemini generateContent body into an ApiResponse
+func decodeGemini(source string, body []byte) ApiResponse {
+	var result geminiResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return ApiResponse{Source: source, Error: fmt.Sprintf("decode error: %v", err)}
+	}
+	if result.Error != nil {
+		return ApiResponse{Source: source, Error: fmt.Sprintf("provider error: %s %s", result.Error.Status, result.Error.Message)}
+	}
+	if fb := result.PromptFeedback; fb != nil && fb.BlockReason != "" {
+		return ApiResponse{
+			Source:       source,
+			Model:        result.ModelVersion,
+			Usage:        result.usage(),
+			FinishReason: fb.BlockReason,
+			Safety:       &SafetyBlock{Reason: fb.BlockReason, Ratings: toSafetyRatings(fb.SafetyRatings)},
+			Error:        fmt.Sprintf("prompt blocked: %s", fb.BlockReason),
+		}
+	}
+	if len(result.Candidates) == 0 {
+		return ApiResponse{Source: source, Error: "no candidates in response"}
+	}
+
+	candidate := result.Candidates[0]
+	var text strings.Builder
+	for _, part := range candidate.Content.Parts {
+		text.WriteString(part.Text)
+	}
+	resp := ApiResponse{
+		Source:       source,
+		Message:      text.String(),
+		FinishReason: candidate.FinishReason,
+		Model:        result.ModelVersion,
+		Usage:        result.usage(),
+	}
+	if geminiBlockedFinishReasons[candidate.FinishReason] {
+		resp.Safety = &SafetyBlock{Reason: candidate.FinishReason, Ratings: toSafetyRatings(candidate.SafetyRatings)}
+		if resp.Message == "" {
+			resp.Error = fmt.Sprintf("response blocked: %s", candidate.FinishReason)
+		}
+	}
+	return resp
+}
+
+// usage returns the token counts in r's usageMetadata, if any
+func (r *geminiResponse) usage() *Usage {
+	if r.UsageMetadata == nil {
+		return nil
+	}
+	return &Usage{InputTokens: r.UsageMetadata.PromptTokenCount, OutputTokens: r.UsageMetadata.CandidatesTokenCount}
+}
+
+func toSafetyRatings(ratings []geminiSafetyRating) []SafetyRating {
+	if len(ratings) == 0 {
+		return nil
+	}
+	out := make([]SafetyRating, len(ratings))
+	for i, r := range ratings {
+		out[i] = SafetyRating{Category: r.Category, Probability: r.Probability, Blocked: r.Blocked}
+	}
+	return out
+}
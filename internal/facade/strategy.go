@@ -0,0 +1,254 @@
+package facade
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Merge strategies selectable per request
+const (
+	StrategyAll             = "all"              // Wait for every provider and return all results
+	StrategyFirstSuccessful = "first-successful" // Return as soon as one provider succeeds
+	StrategyFastestN        = "fastest-n"        // Return once N providers have succeeded
+	StrategyConsensus       = "consensus"        // Pick the answer most providers agree on
+	StrategyJudge           = "judge"            // Let the judge model pick or synthesize the best answer
+)
+
+// MergeOptions selects how the facade combines provider results
+type MergeOptions struct {
+	Strategy string `json:"strategy,omitempty"` // One of the Strategy* constants; empty means StrategyAll
+	N        int    `json:"n,omitempty"`        // Result count for StrategyFastestN; defaults to 1
+}
+
+// Validate checks the strategy is known
+func (m MergeOptions) Validate() error {
+	var errs ValidationError
+	switch m.Strategy {
+	case "", StrategyAll, StrategyFirstSuccessful, StrategyFastestN, StrategyConsensus, StrategyJudge:
+	default:
+		errs.add("strategy", fmt.Sprintf("unknown merge strategy %q", m.Strategy))
+	}
+	if m.N < 0 {
+		errs.add("n", "must not be negative")
+	}
+	return errs.err()
+}
+
+func (m MergeOptions) strategy() string {
+	if m.Strategy == "" {
+		return StrategyAll
+	}
+	return m.Strategy
+}
+
+func (m MergeOptions) n() int {
+	if m.N <= 0 {
+		return 1
+	}
+	return m.N
+}
+
+// enough reports whether the results collected so far already decide the
+// outcome, so the remaining provider calls can be cancelled
+func (m MergeOptions) enough(results []ApiResponse, total int) bool {
+	switch m.strategy() {
+	case StrategyFirstSuccessful:
+		return countSuccessful(results) >= 1
+	case StrategyFastestN:
+		return countSuccessful(results) >= m.n()
+	case StrategyConsensus:
+		// A strict majority of all providers cannot be outvoted
+		_, votes := largestGroup(results)
+		return votes > total/2
+	default:
+		return false
+	}
+}
+
+// merge fills in the strategy's output and rationale on merged
+func (f *Facade) merge(ctx context.Context, req Request, merged *MergedApiResponse) {
+	merged.Strategy = req.Merge.strategy()
+	successful := successfulResults(merged.Results)
+
+	switch merged.Strategy {
+	case StrategyFirstSuccessful:
+		if len(successful) == 0 {
+			merged.Rationale = "no provider succeeded"
+			return
+		}
+		merged.Output = successful[0].Message
+		merged.Selected = []string{successful[0].Source}
+		merged.Rationale = fmt.Sprintf("%s answered first", successful[0].Source)
+
+	case StrategyFastestN:
+		n := req.Merge.n()
+		if len(successful) > n {
+			successful = successful[:n]
+		}
+		for _, r := range successful {
+			merged.Selected = append(merged.Selected, r.Source)
+		}
+		if len(successful) > 0 {
+			merged.Output = successful[0].Message
+		}
+		merged.Rationale = fmt.Sprintf("fastest %d of %d requested successful providers", len(successful), n)
+
+	case StrategyConsensus:
+		group, votes := largestGroup(merged.Results)
+		if votes == 0 {
+			merged.Rationale = "no provider succeeded"
+			return
+		}
+		merged.Output = group[0].Message
+		for _, r := range group {
+			merged.Selected = append(merged.Selected, r.Source)
+		}
+		merged.Rationale = fmt.Sprintf("%d of %d successful providers agreed", votes, len(successful))
+
+	case StrategyJudge:
+		f.judge(ctx, req, merged, successful)
+	}
+}
+
+// judgeVerdict is the JSON the judge model is asked to reply with
+type judgeVerdict struct {
+	Choice    string `json:"choice"`
+	Answer    string `json:"answer"`
+	Rationale string `json:"rationale"`
+}
+
+// judge asks the configured judge model to pick or synthesize the best answer
+func (f *Facade) judge(ctx context.Context, req Request, merged *MergedApiResponse, successful []ApiResponse) {
+	switch {
+	case f.judgeClient == nil:
+		merged.Rationale = "judge strategy unavailable: no JUDGE_PROVIDER configured"
+		return
+	case len(successful) == 0:
+		merged.Rationale = "no provider succeeded"
+		return
+	case len(successful) == 1:
+		merged.Output = successful[0].Message
+		merged.Selected = []string{successful[0].Source}
+		merged.Rationale = "only one provider succeeded; judge not consulted"
+		return
+	}
+
+	var prompt strings.Builder
+	prompt.WriteString("Several assistants answered the conversation below. Pick the best answer, or write a better one that combines their strengths.\n")
+	prompt.WriteString("Reply with only a JSON object: {\"choice\": \"<name of the chosen assistant, or empty if you wrote a new answer>\", \"answer\": \"<final answer>\", \"rationale\": \"<one or two sentences>\"}\n\n")
+	prompt.WriteString("Conversation:\n")
+	for _, m := range req.Messages {
+		fmt.Fprintf(&prompt, "[%s] %s\n", m.Role, m.Content)
+	}
+	prompt.WriteString("\nAnswers:\n")
+	for _, r := range successful {
+		fmt.Fprintf(&prompt, "--- %s ---\n%s\n", r.Source, r.Message)
+	}
+
+	judgeReq := Request{
+		Messages: []ChatMessage{{Role: RoleUser, Content: prompt.String()}},
+		Options:  GenerationOptions{Models: map[string]string{strings.ToLower(f.judgeClient.Source()): f.judgeModel}},
+	}
+	resp := f.judgeClient.Call(ctx, judgeReq)
+	merged.Judge = &resp
+	if resp.Error != "" {
+		merged.Output = successful[0].Message
+		merged.Selected = []string{successful[0].Source}
+		merged.Rationale = fmt.Sprintf("judge %s failed (%s); fell back to first successful answer", resp.Source, resp.Error)
+		return
+	}
+
+	var verdict judgeVerdict
+	if err := json.Unmarshal([]byte(extractJSONObject(resp.Message)), &verdict); err != nil || verdict.Answer == "" && verdict.Choice == "" {
+		merged.Output = resp.Message
+		merged.Rationale = fmt.Sprintf("judge %s replied without a structured verdict", resp.Source)
+		return
+	}
+	merged.Output = verdict.Answer
+	merged.Rationale = fmt.Sprintf("judge %s: %s", resp.Source, verdict.Rationale)
+	for _, r := range successful {
+		if strings.EqualFold(r.Source, verdict.Choice) {
+			merged.Selected = []string{r.Source}
+			if merged.Output == "" {
+				merged.Output = r.Message
+			}
+			break
+		}
+	}
+}
+
+// extractJSONObject trims any prose or code fences around the first JSON object
+func extractJSONObject(s string) string {
+	start, end := strings.Index(s, "{"), strings.LastIndex(s, "}")
+	if start < 0 || end < start {
+		return s
+	}
+	return s[start : end+1]
+}
+
+// largestGroup groups successful results by normalized answer and returns
+// the biggest group; ties go to the group whose first answer arrived first
+func largestGroup(results []ApiResponse) ([]ApiResponse, int) {
+	groups := make(map[string][]ApiResponse)
+	var order []string
+	for _, r := range results {
+		if r.Error != "" {
+			continue
+		}
+		key := normalizeAnswer(r.Message)
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], r)
+	}
+	var best []ApiResponse
+	for _, key := range order {
+		if len(groups[key]) > len(best) {
+			best = groups[key]
+		}
+	}
+	return best, len(best)
+}
+
+// normalizeAnswer folds case, whitespace and punctuation so that trivially
+// different phrasings of the same short answer compare equal
+func normalizeAnswer(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			space = false
+			b.WriteRune(r)
+		default:
+			space = true
+		}
+	}
+	return b.String()
+}
+
+func successfulResults(results []ApiResponse) []ApiResponse {
+	var ok []ApiResponse
+	for _, r := range results {
+		if r.Error == "" {
+			ok = append(ok, r)
+		}
+	}
+	return ok
+}
+
+func countSuccessful(results []ApiResponse) int {
+	n := 0
+	for _, r := range results {
+		if r.Error == "" {
+			n++
+		}
+	}
+	return n
+}
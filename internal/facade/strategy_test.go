@@ -0,0 +1,147 @@
+package facade
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// answers are four provider results: three successes, two of which agree
+// once case and punctuation are folded, and one failure
+var answers = []ApiResponse{
+	{Source: "OpenAI", Message: "Paris."},
+	{Source: "Gemini", Error: "status 503"},
+	{Source: "Anthropic", Message: "The capital is Paris"},
+	{Source: "Local", Message: "paris"},
+}
+
+// mergeResults applies the request's strategy to results
+func mergeResults(f *Facade, req Request, results []ApiResponse) MergedApiResponse {
+	merged := MergedApiResponse{Results: results}
+	f.merge(context.Background(), req, &merged)
+	return merged
+}
+
+func TestMergeStrategies(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		merge    MergeOptions
+		results  []ApiResponse
+		output   string
+		selected []string
+	}{
+		{name: "all", merge: MergeOptions{}, results: answers},
+		{name: "first successful", merge: MergeOptions{Strategy: StrategyFirstSuccessful}, results: answers,
+			output: "Paris.", selected: []string{"OpenAI"}},
+		{name: "first successful, none", merge: MergeOptions{Strategy: StrategyFirstSuccessful}, results: answers[1:2]},
+		{name: "fastest 2", merge: MergeOptions{Strategy: StrategyFastestN, N: 2}, results: answers,
+			output: "Paris.", selected: []string{"OpenAI", "Anthropic"}},
+		{name: "fastest n defaults to 1", merge: MergeOptions{Strategy: StrategyFastestN}, results: answers,
+			output: "Paris.", selected: []string{"OpenAI"}},
+		{name: "consensus", merge: MergeOptions{Strategy: StrategyConsensus}, results: answers,
+			output: "Paris.", selected: []string{"OpenAI", "Local"}},
+		{name: "consensus, none", merge: MergeOptions{Strategy: StrategyConsensus}, results: answers[1:2]},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			merged := mergeResults(&Facade{}, Request{Merge: tc.merge}, tc.results)
+			if merged.Strategy != tc.merge.strategy() {
+				t.Errorf("Strategy = %q", merged.Strategy)
+			}
+			if merged.Output != tc.output || !reflect.DeepEqual(merged.Selected, tc.selected) {
+				t.Errorf("got %q from %v, want %q from %v", merged.Output, merged.Selected, tc.output, tc.selected)
+			}
+			if tc.output == "" && tc.merge.Strategy != "" && merged.Rationale != "no provider succeeded" {
+				t.Errorf("Rationale = %q", merged.Rationale)
+			}
+		})
+	}
+}
+
+func TestMergeJudge(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		judge    *ApiResponse // nil for no judge configured
+		results  []ApiResponse
+		output   string
+		selected []string
+	}{
+		{name: "no judge", results: answers},
+		{name: "one answer, judge not consulted", judge: &ApiResponse{Source: "Judge", Message: "unused"}, results: answers[:2],
+			output: "Paris.", selected: []string{"OpenAI"}},
+		{name: "verdict picks an answer", results: answers,
+			judge:  &ApiResponse{Source: "Judge", Message: "```json\n{\"choice\": \"anthropic\", \"answer\": \"\", \"rationale\": \"most complete\"}\n```"},
+			output: "The capital is Paris", selected: []string{"Anthropic"}},
+		{name: "verdict writes its own answer", results: answers,
+			judge:  &ApiResponse{Source: "Judge", Message: `{"choice": "", "answer": "Paris, France", "rationale": "combined"}`},
+			output: "Paris, France"},
+		{name: "unstructured verdict", results: answers,
+			judge:  &ApiResponse{Source: "Judge", Message: "I think Paris"},
+			output: "I think Paris"},
+		{name: "judge fails", results: answers,
+			judge:  &ApiResponse{Source: "Judge", Error: "status 500"},
+			output: "Paris.", selected: []string{"OpenAI"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := &Facade{}
+			if tc.judge != nil {
+				f.judgeClient = &fakeClient{resp: *tc.judge}
+			}
+			merged := mergeResults(f, Request{Merge: MergeOptions{Strategy: StrategyJudge}}, tc.results)
+			if merged.Output != tc.output || !reflect.DeepEqual(merged.Selected, tc.selected) {
+				t.Errorf("got %q from %v, want %q from %v (%s)", merged.Output, merged.Selected, tc.output, tc.selected, merged.Rationale)
+			}
+			consulted := tc.judge != nil && len(successfulResults(tc.results)) > 1
+			if consulted != (merged.Judge != nil) {
+				t.Errorf("Judge = %+v, want consulted=%v", merged.Judge, consulted)
+			}
+		})
+	}
+}
+
+func TestMergeEnough(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		merge   MergeOptions
+		results []ApiResponse
+		total   int
+		want    bool
+	}{
+		{"all never decides early", MergeOptions{Strategy: StrategyAll}, answers, 5, false},
+		{"first successful after a failure", MergeOptions{Strategy: StrategyFirstSuccessful}, answers[1:2], 4, false},
+		{"first successful", MergeOptions{Strategy: StrategyFirstSuccessful}, answers[:1], 4, true},
+		{"fastest 2 of 1", MergeOptions{Strategy: StrategyFastestN, N: 2}, answers[:2], 4, false},
+		{"fastest 2 of 2", MergeOptions{Strategy: StrategyFastestN, N: 2}, answers[:3], 4, true},
+		{"consensus of 2 of 4 can be outvoted", MergeOptions{Strategy: StrategyConsensus}, answers, 4, false},
+		{"consensus of 2 of 3 cannot", MergeOptions{Strategy: StrategyConsensus}, answers, 3, true},
+		{"judge waits for everyone", MergeOptions{Strategy: StrategyJudge}, answers, 4, false},
+	} {
+		if got := tc.merge.enough(tc.results, tc.total); got != tc.want {
+			t.Errorf("%s: enough = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestNormalizeAnswer(t *testing.T) {
+	for in, want := range map[string]string{
+		"Paris.":              "paris",
+		"  The  Answer: 42! ": "the answer 42",
+		"Ça va?":              "ça va",
+		"":                    "",
+	} {
+		if got := normalizeAnswer(in); got != want {
+			t.Errorf("normalizeAnswer(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestMergeOptionsValidate(t *testing.T) {
+	if err := (MergeOptions{Strategy: StrategyFastestN, N: 2}).Validate(); err != nil {
+		t.Errorf("valid options: %v", err)
+	}
+	if err := (MergeOptions{Strategy: "majority"}).Validate(); err == nil {
+		t.Error("unknown strategy accepted")
+	}
+	if err := (MergeOptions{N: -1}).Validate(); err == nil {
+		t.Error("negative n accepted")
+	}
+}
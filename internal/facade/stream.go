@@ -0,0 +1,310 @@
+package facade
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// StreamEvent is one chunk of a streamed provider response. Each provider
+// ends its stream with exactly one event where Done is set; that event
+// carries the complete response, or the error that ended the stream.
+type StreamEvent struct {
+	Source       string       `json:"source"`
+	Delta        string       `json:"delta,omitempty"`
+	Done         bool         `json:"done,omitempty"`
+	FinishReason string       `json:"finish_reason,omitempty"`
+	Error        string       `json:"error,omitempty"`
+	Response     *ApiResponse `json:"response,omitempty"` // Accumulated response, set on the Done event
+}
+
+// Streamer is implemented by clients that can stream tokens as they are
+// generated. The returned channel is closed after the Done event.
+type Streamer interface {
+	Stream(ctx context.Context, req Request) (<-chan StreamEvent, error)
+}
+
+// Stream calls every provider concurrently and multiplexes their token
+// deltas into one channel, tagged by Source. Clients that do not stream
+// are called normally and contribute a single delta. The channel is closed
+// once every provider has sent its Done event.
+func (f *Facade) Stream(ctx context.Context, req Request) <-chan StreamEvent {
+	var cancel context.CancelFunc = func() {}
+	if f.requestTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, f.requestTimeout)
+	}
+
+	out := make(chan StreamEvent)
+	var wg sync.WaitGroup
+	for _, client := range f.clientsFor(req) {
+		wg.Add(1)
+		go func(c AIClient) {
+			defer wg.Done()
+			for ev := range streamClient(ctx, c, req) {
+				select {
+				case out <- ev:
+				case <-ctx.Done():
+					// Keep draining so the client's goroutine can exit
+				}
+			}
+		}(client)
+	}
+	go func() {
+		wg.Wait()
+		cancel()
+		close(out)
+	}()
+	return out
+}
+
+// streamClient streams one client, falling back to Call for clients that
+// do not implement Streamer
+func streamClient(ctx context.Context, c AIClient, req Request) <-chan StreamEvent {
+	if s, ok := c.(Streamer); ok {
+		events, err := s.Stream(ctx, req)
+		if err == nil {
+			return events
+		}
+		return singleEvent(ApiResponse{Source: c.Source(), Error: err.Error()})
+	}
+	return singleEvent(c.Call(ctx, req))
+}
+
+// singleEvent turns a complete response into a one-delta stream
+func singleEvent(resp ApiResponse) <-chan StreamEvent {
+	out := make(chan StreamEvent, 2)
+	if resp.Error == "" && resp.Message != "" {
+		out <- StreamEvent{Source: resp.Source, Delta: resp.Message}
+	}
+	out <- StreamEvent{Source: resp.Source, Done: true, FinishReason: resp.FinishReason, Error: resp.Error, Response: &resp}
+	close(out)
+	return out
+}
+
+// streamChunk is what a provider-specific decoder extracts from one frame
+type streamChunk struct {
+	Delta        string
+	FinishReason string
+	Safety       *SafetyBlock
+	Model        string
+	Usage        *Usage // Token counts so far; non-zero fields replace earlier ones
+	Done         bool   // Provider signalled the end of the stream
+}
+
+// pumpStream drives next until the stream ends, forwarding deltas and
+// finishing with a Done event holding the accumulated response. next
+// returns io.EOF at the end of the body.
+func pumpStream(ctx context.Context, source string, body io.ReadCloser, next func() (streamChunk, error)) <-chan StreamEvent {
+	out := make(chan StreamEvent)
+	go func() {
+		defer close(out)
+		defer body.Close()
+		// Closing the body unblocks a pending read once ctx is cancelled
+		stop := context.AfterFunc(ctx, func() { body.Close() })
+		defer stop()
+
+		send := func(ev StreamEvent) bool {
+			select {
+			case out <- ev:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		final := ApiResponse{Source: source}
+		var text strings.Builder
+		for {
+			chunk, err := next()
+			if err != nil {
+				if ctx.Err() != nil {
+					final.Error = ctx.Err().Error()
+				} else if !errors.Is(err, io.EOF) {
+					final.Error = fmt.Sprintf("stream error: %v", err)
+				}
+				break
+			}
+			if chunk.Delta != "" {
+				text.WriteString(chunk.Delta)
+				if !send(StreamEvent{Source: source, Delta: chunk.Delta}) {
+					final.Error = ctx.Err().Error()
+					break
+				}
+			}
+			if chunk.FinishReason != "" {
+				final.FinishReason = chunk.FinishReason
+			}
+			if chunk.Safety != nil {
+				final.Safety = chunk.Safety
+			}
+			if chunk.Model != "" {
+				final.Model = chunk.Model
+			}
+			if u := chunk.Usage; u != nil {
+				if final.Usage == nil {
+					final.Usage = &Usage{}
+				}
+				if u.InputTokens > 0 {
+					final.Usage.InputTokens = u.InputTokens
+				}
+				if u.OutputTokens > 0 {
+					final.Usage.OutputTokens = u.OutputTokens
+				}
+			}
+			if chunk.Done {
+				break
+			}
+		}
+		final.Message = text.String()
+		if final.Error == "" && final.Safety != nil && final.Message == "" {
+			final.Error = fmt.Sprintf("response blocked: %s", final.Safety.Reason)
+		}
+		// Deliver the final event even if ctx was cancelled, so consumers
+		// always see one Done per provider; Facade.Stream keeps draining.
+		out <- StreamEvent{Source: source, Done: true, FinishReason: final.FinishReason, Error: final.Error, Response: &final}
+	}()
+	return out
+}
+
+// sseEvent is one Server-Sent Events frame
+type sseEvent struct {
+	Event string
+	Data  string
+}
+
+// sseReader splits a text/event-stream body into events
+type sseReader struct {
+	scanner *bufio.Scanner
+}
+
+func newSSEReader(r io.Reader) *sseReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return &sseReader{scanner: scanner}
+}
+
+// Next returns the next event with a non-empty data field, or io.EOF
+func (r *sseReader) Next() (sseEvent, error) {
+	var ev sseEvent
+	var data []string
+	for r.scanner.Scan() {
+		line := r.scanner.Text()
+		switch {
+		case line == "":
+			if len(data) > 0 {
+				ev.Data = strings.Join(data, "\n")
+				return ev, nil
+			}
+			ev = sseEvent{}
+		case strings.HasPrefix(line, ":"):
+			// Comment / keep-alive
+		case strings.HasPrefix(line, "event:"):
+			ev.Event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := r.scanner.Err(); err != nil {
+		return ev, err
+	}
+	if len(data) > 0 {
+		ev.Data = strings.Join(data, "\n")
+		return ev, nil
+	}
+	return ev, io.EOF
+}
+
+// chatCompletionChunk is one OpenAI-style streaming frame
+type chatCompletionChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Model string               `json:"model"`
+	Usage *chatCompletionUsage `json:"usage"` // Sent when stream_options.include_usage is set
+	Error *providerErrorBody   `json:"error"`
+}
+
+// chatCompletionStream decodes an OpenAI-style SSE stream
+func chatCompletionStream(body io.Reader) func() (streamChunk, error) {
+	sse := newSSEReader(body)
+	return func() (streamChunk, error) {
+		for {
+			ev, err := sse.Next()
+			if err != nil {
+				return streamChunk{}, err
+			}
+			if strings.TrimSpace(ev.Data) == "[DONE]" {
+				return streamChunk{Done: true}, nil
+			}
+			var frame chatCompletionChunk
+			if err := json.Unmarshal([]byte(ev.Data), &frame); err != nil {
+				return streamChunk{}, fmt.Errorf("decode error: %v", err)
+			}
+			if frame.Error != nil {
+				return streamChunk{}, fmt.Errorf("provider error: %s", frame.Error.Message)
+			}
+			if len(frame.Choices) == 0 {
+				if frame.Usage == nil {
+					continue
+				}
+				return streamChunk{Model: frame.Model, Usage: frame.Usage.toUsage()}, nil
+			}
+			choice := frame.Choices[0]
+			chunk := streamChunk{Delta: choice.Delta.Content, Model: frame.Model, Usage: frame.Usage.toUsage()}
+			if choice.FinishReason != nil {
+				chunk.FinishReason = *choice.FinishReason
+				if chunk.FinishReason == "content_filter" {
+					chunk.Safety = &SafetyBlock{Reason: chunk.FinishReason}
+				}
+			}
+			return chunk, nil
+		}
+	}
+}
+
+// geminiStream decodes a streamGenerateContent?alt=sse stream, where each
+// frame is a partial generateContent response
+func geminiStream(body io.Reader) func() (streamChunk, error) {
+	sse := newSSEReader(body)
+	return func() (streamChunk, error) {
+		ev, err := sse.Next()
+		if err != nil {
+			return streamChunk{}, err
+		}
+		var frame geminiResponse
+		if err := json.Unmarshal([]byte(ev.Data), &frame); err != nil {
+			return streamChunk{}, fmt.Errorf("decode error: %v", err)
+		}
+		if frame.Error != nil {
+			return streamChunk{}, fmt.Errorf("provider error: %s %s", frame.Error.Status, frame.Error.Message)
+		}
+		if fb := frame.PromptFeedback; fb != nil && fb.BlockReason != "" {
+			return streamChunk{
+				FinishReason: fb.BlockReason,
+				Safety:       &SafetyBlock{Reason: fb.BlockReason, Ratings: toSafetyRatings(fb.SafetyRatings)},
+				Done:         true,
+			}, nil
+		}
+		// Every frame carries the usage so far; the last one has the totals
+		chunk := streamChunk{Model: frame.ModelVersion, Usage: frame.usage()}
+		if len(frame.Candidates) > 0 {
+			candidate := frame.Candidates[0]
+			for _, part := range candidate.Content.Parts {
+				chunk.Delta += part.Text
+			}
+			chunk.FinishReason = candidate.FinishReason
+			if geminiBlockedFinishReasons[candidate.FinishReason] {
+				chunk.Safety = &SafetyBlock{Reason: candidate.FinishReason, Ratings: toSafetyRatings(candidate.SafetyRatings)}
+			}
+		}
+		return chunk, nil
+	}
+}
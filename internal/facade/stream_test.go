@@ -0,0 +1,220 @@
+package facade
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// pump runs decode over body through pumpStream and returns the deltas it
+// forwarded and the response on its Done event
+func pump(t *testing.T, body string, decode func(io.Reader) func() (streamChunk, error)) ([]string, ApiResponse) {
+	t.Helper()
+	r := io.NopCloser(strings.NewReader(body))
+	var deltas []string
+	var final *ApiResponse
+	for ev := range pumpStream(context.Background(), "Test", r, decode(r)) {
+		if final != nil {
+			t.Fatalf("event %+v after Done", ev)
+		}
+		if ev.Done {
+			final = ev.Response
+			continue
+		}
+		deltas = append(deltas, ev.Delta)
+	}
+	if final == nil {
+		t.Fatal("stream ended without a Done event")
+	}
+	return deltas, *final
+}
+
+func TestSSEReader(t *testing.T) {
+	body := ": keep-alive\n\n" +
+		"event: message_start\r\ndata: {\"a\":1}\r\n\r\n" +
+		"data: line one\ndata:line two\n\n" +
+		"event: ping\n\n" +
+		"data: unterminated"
+	r := newSSEReader(strings.NewReader(body))
+	want := []sseEvent{
+		{Event: "message_start", Data: `{"a":1}`},
+		{Data: "line one\nline two"},
+		{Data: "unterminated"},
+	}
+	for i, w := range want {
+		ev, err := r.Next()
+		if err != nil {
+			t.Fatalf("event %d: %v", i, err)
+		}
+		if ev != w {
+			t.Errorf("event %d = %+v, want %+v", i, ev, w)
+		}
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("after last event: err = %v, want io.EOF", err)
+	}
+}
+
+func TestChatCompletionStream(t *testing.T) {
+	body := `data: {"model":"gpt-4o-mini-2024-07-18","choices":[{"delta":{"role":"assistant","content":""},"finish_reason":null}]}
+
+data: {"model":"gpt-4o-mini-2024-07-18","choices":[{"delta":{"content":"Hel"},"finish_reason":null}]}
+
+data: {"model":"gpt-4o-mini-2024-07-18","choices":[{"delta":{"content":"lo"},"finish_reason":null}]}
+
+data: {"model":"gpt-4o-mini-2024-07-18","choices":[{"delta":{},"finish_reason":"stop"}]}
+
+data: {"model":"gpt-4o-mini-2024-07-18","choices":[],"usage":{"prompt_tokens":9,"completion_tokens":2,"total_tokens":11}}
+
+data: [DONE]
+
+data: {"choices":[{"delta":{"content":"ignored"}}]}
+
+`
+	deltas, final := pump(t, body, chatCompletionStream)
+	if !reflect.DeepEqual(deltas, []string{"Hel", "lo"}) {
+		t.Errorf("deltas = %q", deltas)
+	}
+	if final.Message != "Hello" || final.FinishReason != "stop" || final.Model != "gpt-4o-mini-2024-07-18" || final.Error != "" {
+		t.Errorf("final = %+v", final)
+	}
+	if final.Usage == nil || *final.Usage != (Usage{InputTokens: 9, OutputTokens: 2}) {
+		t.Errorf("usage = %+v", final.Usage)
+	}
+}
+
+func TestChatCompletionStreamErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name, body, err string
+		safety          bool
+	}{
+		{name: "error frame", body: "data: {\"error\":{\"message\":\"overloaded\"}}\n\n", err: "stream error: provider error: overloaded"},
+		{name: "bad json", body: "data: {nope\n\n", err: "stream error: decode error"},
+		{name: "content filter", body: "data: {\"choices\":[{\"delta\":{},\"finish_reason\":\"content_filter\"}]}\n\ndata: [DONE]\n\n",
+			err: "response blocked: content_filter", safety: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, final := pump(t, tc.body, chatCompletionStream)
+			if !strings.HasPrefix(final.Error, tc.err) {
+				t.Errorf("error = %q, want prefix %q", final.Error, tc.err)
+			}
+			if (final.Safety != nil) != tc.safety {
+				t.Errorf("safety = %+v", final.Safety)
+			}
+		})
+	}
+}
+
+func TestAnthropicStream(t *testing.T) {
+	body := `event: message_start
+data: {"type":"message_start","message":{"model":"claude-3-5-haiku-20241022","usage":{"input_tokens":25,"output_tokens":1}}}
+
+event: content_block_start
+data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}
+
+event: ping
+data: {"type":"ping"}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{}"}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":" there"}}
+
+event: message_delta
+data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":15}}
+
+event: message_stop
+data: {"type":"message_stop"}
+
+`
+	deltas, final := pump(t, body, anthropicStream)
+	if !reflect.DeepEqual(deltas, []string{"Hi", " there"}) {
+		t.Errorf("deltas = %q", deltas)
+	}
+	if final.Message != "Hi there" || final.FinishReason != "end_turn" || final.Model != "claude-3-5-haiku-20241022" || final.Error != "" {
+		t.Errorf("final = %+v", final)
+	}
+	if final.Usage == nil || *final.Usage != (Usage{InputTokens: 25, OutputTokens: 15}) {
+		t.Errorf("usage = %+v", final.Usage)
+	}
+}
+
+func TestAnthropicStreamError(t *testing.T) {
+	body := "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"Hi\"}}\n\n" +
+		"event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}\n\n"
+	deltas, final := pump(t, body, anthropicStream)
+	if !reflect.DeepEqual(deltas, []string{"Hi"}) {
+		t.Errorf("deltas = %q", deltas)
+	}
+	if final.Error != "stream error: provider error: overloaded_error: Overloaded" || final.Message != "Hi" {
+		t.Errorf("final = %+v", final)
+	}
+}
+
+func TestGeminiStream(t *testing.T) {
+	body := `data: {"candidates":[{"content":{"parts":[{"text":"Bon"}]}}],"usageMetadata":{"promptTokenCount":4,"candidatesTokenCount":1},"modelVersion":"gemini-1.5-flash-002"}
+
+data: {"candidates":[{"content":{"parts":[{"text":"jour"}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":4,"candidatesTokenCount":3},"modelVersion":"gemini-1.5-flash-002"}
+
+`
+	deltas, final := pump(t, body, geminiStream)
+	if !reflect.DeepEqual(deltas, []string{"Bon", "jour"}) {
+		t.Errorf("deltas = %q", deltas)
+	}
+	if final.Message != "Bonjour" || final.FinishReason != "STOP" || final.Model != "gemini-1.5-flash-002" || final.Error != "" {
+		t.Errorf("final = %+v", final)
+	}
+	if final.Usage == nil || *final.Usage != (Usage{InputTokens: 4, OutputTokens: 3}) {
+		t.Errorf("usage = %+v", final.Usage)
+	}
+}
+
+func TestGeminiStreamBlocked(t *testing.T) {
+	body := `data: {"promptFeedback":{"blockReason":"SAFETY","safetyRatings":[{"category":"HARM_CATEGORY_HARASSMENT","probability":"HIGH"}]}}
+
+`
+	deltas, final := pump(t, body, geminiStream)
+	if len(deltas) != 0 {
+		t.Errorf("deltas = %q", deltas)
+	}
+	if final.Safety == nil || final.Safety.Reason != "SAFETY" || final.Error != "response blocked: SAFETY" {
+		t.Errorf("final = %+v", final)
+	}
+}
+
+func TestOllamaStream(t *testing.T) {
+	body := `{"model":"llama3.1","message":{"role":"assistant","content":"Hel"},"done":false}
+
+{"model":"llama3.1","message":{"role":"assistant","content":"lo"},"done":false}
+{"model":"llama3.1","message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":11,"eval_count":2}
+`
+	deltas, final := pump(t, body, ollamaStream)
+	if !reflect.DeepEqual(deltas, []string{"Hel", "lo"}) {
+		t.Errorf("deltas = %q", deltas)
+	}
+	if final.Message != "Hello" || final.FinishReason != "stop" || final.Model != "llama3.1" || final.Error != "" {
+		t.Errorf("final = %+v", final)
+	}
+	if final.Usage == nil || *final.Usage != (Usage{InputTokens: 11, OutputTokens: 2}) {
+		t.Errorf("usage = %+v", final.Usage)
+	}
+}
+
+func TestStreamFallsBackToCall(t *testing.T) {
+	f := &Facade{clients: []AIClient{
+		&fakeClient{resp: ApiResponse{Source: "Plain", Message: "whole answer", FinishReason: "stop"}},
+	}}
+	var events []StreamEvent
+	for ev := range f.Stream(context.Background(), Request{Messages: PromptMessages("", "hi")}) {
+		events = append(events, ev)
+	}
+	if len(events) != 2 || events[0].Delta != "whole answer" || !events[1].Done || events[1].Response.Message != "whole answer" {
+		t.Errorf("events = %+v", events)
+	}
+}
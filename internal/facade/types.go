@@ -1,11 +1,173 @@
 package facade
 
+import (
+	"fmt"
+	"strings"
+)
+
 type ApiResponse struct {
-	Source  string `json:"source"`
-	Message string `json:"message"`
-	Error   string `json:"error",omitempty`
+	Source       string       `json:"source"`
+	Message      string       `json:"message"`
+	FinishReason string       `json:"finish_reason,omitempty"` // Provider's stop reason, as reported
+	Safety       *SafetyBlock `json:"safety,omitempty"`        // Set when a safety filter withheld or cut the answer
+	Error        string       `json:"error,omitempty"`
+	Model        string       `json:"model,omitempty"`      // Model that answered, as reported by the provider
+	Usage        *Usage       `json:"usage,omitempty"`      // Set when the provider reported token counts
+	LatencyMs    int64        `json:"latency_ms,omitempty"` // Time the facade waited for this answer
+}
+
+// Usage is the tokens a call consumed and what they cost
+type Usage struct {
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	Cost         float64 `json:"cost"` // USD from the price table; 0 for unpriced models
+}
+
+// Add adds o to u
+func (u *Usage) Add(o Usage) {
+	u.InputTokens += o.InputTokens
+	u.OutputTokens += o.OutputTokens
+	u.Cost += o.Cost
+}
+
+// SafetyBlock describes why a provider's safety system blocked a response
+type SafetyBlock struct {
+	Reason  string         `json:"reason"`
+	Ratings []SafetyRating `json:"ratings,omitempty"`
+}
+
+// SafetyRating is one category score reported with a safety block
+type SafetyRating struct {
+	Category    string `json:"category"`
+	Probability string `json:"probability"`
+	Blocked     bool   `json:"blocked,omitempty"`
 }
 
 type MergedApiResponse struct {
-	Results []ApiResponse `json:"results"`
+	Results   []ApiResponse `json:"results"`
+	Strategy  string        `json:"strategy,omitempty"`  // Merge strategy that produced Output
+	Output    string        `json:"output,omitempty"`    // Chosen or synthesized answer
+	Selected  []string      `json:"selected,omitempty"`  // Sources the output was taken from
+	Rationale string        `json:"rationale,omitempty"` // Why the strategy chose Output
+	Judge     *ApiResponse  `json:"judge,omitempty"`     // The judge's own call, kept for its usage
+	Late      []ApiResponse `json:"late,omitempty"`      // Answers that arrived after the strategy was satisfied; billed, not merged
+	Usage     Usage         `json:"usage"`               // Totals over Results, Judge and Late
+}
+
+// Roles of the participants in a conversation
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// ChatMessage is one turn of a conversation
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// PromptMessages builds a single-turn conversation, with an optional system prompt
+func PromptMessages(system, prompt string) []ChatMessage {
+	var msgs []ChatMessage
+	if system != "" {
+		msgs = append(msgs, ChatMessage{Role: RoleSystem, Content: system})
+	}
+	return append(msgs, ChatMessage{Role: RoleUser, Content: prompt})
+}
+
+// AnySucceeded reports whether at least one provider returned an answer
+func (m MergedApiResponse) AnySucceeded() bool {
+	for _, r := range m.Results {
+		if r.Error == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Request is one conversation sent to the facade, and through it to each provider
+type Request struct {
+	Messages  []ChatMessage     `json:"messages"`
+	Options   GenerationOptions `json:"options,omitempty"`
+	Merge     MergeOptions      `json:"merge,omitempty"`
+	Providers []string          `json:"providers,omitempty"` // Subset of the configured providers to call; empty for all
+}
+
+// Validate checks the conversation and options are usable by every
+// provider. A failure is a ValidationError naming every invalid field.
+func (r Request) Validate() error {
+	var errs ValidationError
+	errs.merge("", ValidateMessages(r.Messages))
+	errs.merge("options.", r.Options.Validate())
+	errs.merge("merge.", r.Merge.Validate())
+	for i, p := range r.Providers {
+		if strings.TrimSpace(p) == "" {
+			errs.add(fmt.Sprintf("providers[%d]", i), "empty provider name")
+		}
+	}
+	return errs.err()
+}
+
+// ValidateMessages checks roles are known and the conversation has at
+// least one non-system turn
+func ValidateMessages(msgs []ChatMessage) error {
+	var errs ValidationError
+	turns := 0
+	for i, m := range msgs {
+		switch m.Role {
+		case RoleSystem:
+		case RoleUser, RoleAssistant:
+			turns++
+		default:
+			errs.add(fmt.Sprintf("messages[%d].role", i), fmt.Sprintf("unknown role %q", m.Role))
+		}
+		if strings.TrimSpace(m.Content) == "" {
+			errs.add(fmt.Sprintf("messages[%d].content", i), "empty content")
+		}
+	}
+	if turns == 0 {
+		errs.add("messages", "must include at least one user or assistant turn")
+	}
+	return errs.err()
+}
+
+// GenerationOptions tunes generation for one request. Zero values leave
+// the provider's default in place.
+type GenerationOptions struct {
+	Models      map[string]string `json:"models,omitempty"` // Model per provider name, e.g. {"openai": "gpt-4o"}
+	Temperature *float64          `json:"temperature,omitempty"`
+	TopP        *float64          `json:"top_p,omitempty"`
+	MaxTokens   int               `json:"max_tokens,omitempty"`
+	Stop        []string          `json:"stop,omitempty"`
+	Seed        *int64            `json:"seed,omitempty"`
+}
+
+// ModelFor returns the model requested for the provider with the given
+// Source(), or fallback when none was requested
+func (o GenerationOptions) ModelFor(source, fallback string) string {
+	for name, model := range o.Models {
+		if strings.EqualFold(name, source) && model != "" {
+			return model
+		}
+	}
+	return fallback
+}
+
+// Validate checks the options are within the ranges providers accept
+func (o GenerationOptions) Validate() error {
+	var errs ValidationError
+	if o.Temperature != nil && (*o.Temperature < 0 || *o.Temperature > 2) {
+		errs.add("temperature", "must be between 0 and 2")
+	}
+	if o.TopP != nil && (*o.TopP < 0 || *o.TopP > 1) {
+		errs.add("top_p", "must be between 0 and 1")
+	}
+	if o.MaxTokens < 0 {
+		errs.add("max_tokens", "must not be negative")
+	}
+	if len(o.Stop) > 4 {
+		errs.add("stop", "at most 4 stop sequences are supported")
+	}
+	return errs.err()
 }
@@ -0,0 +1,131 @@
+package facade
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Price is what a model charges in USD per million tokens
+type Price struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// DefaultPrices are list prices for common models; PRICES_FILE adds to
+// and overrides them
+var DefaultPrices = map[string]Price{
+	"gpt-4o":            {Input: 2.5, Output: 10},
+	"gpt-4o-mini":       {Input: 0.15, Output: 0.6},
+	"gemini-1.5-flash":  {Input: 0.075, Output: 0.3},
+	"gemini-1.5-pro":    {Input: 1.25, Output: 5},
+	"claude-3-5-haiku":  {Input: 0.8, Output: 4},
+	"claude-3-5-sonnet": {Input: 3, Output: 15},
+}
+
+// priceFor returns the price of model, matching the longest price-table
+// key that model starts with, so dated versions like gpt-4o-2024-08-06
+// use the gpt-4o price
+func priceFor(prices map[string]Price, model string) (Price, bool) {
+	model = strings.ToLower(model)
+	if p, ok := prices[model]; ok {
+		return p, true
+	}
+	var best string
+	for name := range prices {
+		if len(name) > len(best) && strings.HasPrefix(model, name) {
+			best = name
+		}
+	}
+	if best == "" {
+		return Price{}, false
+	}
+	return prices[best], true
+}
+
+// defaultModeler is implemented by clients that know their default model
+type defaultModeler interface {
+	DefaultModel() string
+}
+
+// defaultModel returns c's default model, or "" if it does not say
+func defaultModel(c AIClient) string {
+	if m, ok := c.(defaultModeler); ok {
+		return m.DefaultModel()
+	}
+	return ""
+}
+
+// meteredClient is an AIClient that stamps each response with its latency
+// and the cost of the tokens the provider reported
+type meteredClient struct {
+	AIClient
+	prices map[string]Price
+	model  string // Default model, for providers that do not report one
+}
+
+// DefaultModel returns the wrapped client's default model
+func (c *meteredClient) DefaultModel() string {
+	return c.model
+}
+
+func (c *meteredClient) Call(ctx context.Context, req Request) ApiResponse {
+	start := time.Now()
+	resp := c.AIClient.Call(ctx, req)
+	c.meter(&resp, req, start)
+	return resp
+}
+
+// Stream streams the wrapped client, metering the response carried by its
+// Done event
+func (c *meteredClient) Stream(ctx context.Context, req Request) (<-chan StreamEvent, error) {
+	start := time.Now()
+	events := streamClient(ctx, c.AIClient, req)
+	out := make(chan StreamEvent)
+	go func() {
+		defer close(out)
+		for ev := range events {
+			if ev.Done && ev.Response != nil {
+				c.meter(ev.Response, req, start)
+			}
+			out <- ev
+		}
+	}()
+	return out, nil
+}
+
+// meter fills in resp's latency, its model when the provider did not name
+// one, and the cost of its usage
+func (c *meteredClient) meter(resp *ApiResponse, req Request, start time.Time) {
+	resp.LatencyMs = time.Since(start).Milliseconds()
+	if resp.Model == "" {
+		resp.Model = req.Options.ModelFor(c.Source(), c.model)
+	}
+	if resp.Usage == nil {
+		return
+	}
+	if p, ok := priceFor(c.prices, resp.Model); ok {
+		resp.Usage.Cost = (float64(resp.Usage.InputTokens)*p.Input + float64(resp.Usage.OutputTokens)*p.Output) / 1e6
+	}
+}
+
+// Calls returns every provider call behind m: the merged results, the
+// judge's call and answers that arrived too late to be merged
+func (m *MergedApiResponse) Calls() []ApiResponse {
+	calls := append(m.Results[:len(m.Results):len(m.Results)], m.Late...)
+	if m.Judge != nil {
+		calls = append(calls, *m.Judge)
+	}
+	return calls
+}
+
+// TotalUsage sums the usage of every provider call behind m
+func (m *MergedApiResponse) TotalUsage() Usage {
+	var total Usage
+	for _, r := range m.Calls() {
+		if r.Usage != nil {
+			total.Add(*r.Usage)
+		}
+	}
+	return total
+}
@@ -0,0 +1,79 @@
+package facade
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestPriceFor(t *testing.T) {
+	for _, tc := range []struct {
+		model string
+		want  string // Price table key expected to match; "" for none
+	}{
+		{"gpt-4o", "gpt-4o"},
+		{"gpt-4o-2024-08-06", "gpt-4o"},
+		{"gpt-4o-mini", "gpt-4o-mini"},
+		{"gpt-4o-mini-2024-07-18", "gpt-4o-mini"}, // The longest prefix wins
+		{"GPT-4o-Mini", "gpt-4o-mini"},
+		{"claude-3-5-sonnet-20241022", "claude-3-5-sonnet"},
+		{"gemini-1.5-flash-002", "gemini-1.5-flash"},
+		{"gpt-4", ""},
+		{"llama3.1", ""},
+		{"", ""},
+	} {
+		got, ok := priceFor(DefaultPrices, tc.model)
+		if ok != (tc.want != "") || got != DefaultPrices[tc.want] {
+			t.Errorf("priceFor(%q) = %+v, %v; want the %q price", tc.model, got, ok, tc.want)
+		}
+	}
+}
+
+func TestMeteredClient(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		resp  ApiResponse
+		model string // Requested model, when the provider does not name one
+		want  ApiResponse
+	}{
+		{
+			name:  "reported model",
+			resp:  ApiResponse{Model: "gpt-4o-2024-08-06", Usage: &Usage{InputTokens: 1000, OutputTokens: 500}},
+			model: "gpt-4o-mini",
+			want:  ApiResponse{Model: "gpt-4o-2024-08-06", Usage: &Usage{InputTokens: 1000, OutputTokens: 500, Cost: 0.0075}},
+		},
+		{
+			name:  "requested model",
+			resp:  ApiResponse{Usage: &Usage{InputTokens: 1000, OutputTokens: 500}},
+			model: "gpt-4o-mini-2024-07-18",
+			want:  ApiResponse{Model: "gpt-4o-mini-2024-07-18", Usage: &Usage{InputTokens: 1000, OutputTokens: 500, Cost: 0.00045}},
+		},
+		{
+			name: "unpriced model",
+			resp: ApiResponse{Model: "llama3.1", Usage: &Usage{InputTokens: 1000, OutputTokens: 500}},
+			want: ApiResponse{Model: "llama3.1", Usage: &Usage{InputTokens: 1000, OutputTokens: 500}},
+		},
+		{
+			name: "no usage",
+			resp: ApiResponse{Model: "gpt-4o"},
+			want: ApiResponse{Model: "gpt-4o"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.resp.Source = "OpenAI"
+			c := &meteredClient{AIClient: &fakeClient{resp: tc.resp}, prices: DefaultPrices}
+			req := Request{Messages: PromptMessages("", "hi")}
+			if tc.model != "" {
+				req.Options.Models = map[string]string{"openai": tc.model}
+			}
+			got := c.Call(context.Background(), req)
+			if got.Model != tc.want.Model || (got.Usage == nil) != (tc.want.Usage == nil) {
+				t.Fatalf("got %+v, want %+v", got, tc.want)
+			}
+			if got.Usage != nil && (got.Usage.InputTokens != tc.want.Usage.InputTokens ||
+				math.Abs(got.Usage.Cost-tc.want.Usage.Cost) > 1e-12) {
+				t.Errorf("usage = %+v, want %+v", *got.Usage, *tc.want.Usage)
+			}
+		})
+	}
+}
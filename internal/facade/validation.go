@@ -0,0 +1,54 @@
+package facade
+
+import (
+	"errors"
+	"strings"
+)
+
+// FieldError describes one invalid field of a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every invalid field found in a request
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	parts := make([]string, len(e))
+	for i, f := range e {
+		parts[i] = f.Field + ": " + f.Message
+	}
+	return strings.Join(parts, "; ")
+}
+
+// add records a problem with field
+func (e *ValidationError) add(field, message string) {
+	*e = append(*e, FieldError{Field: field, Message: message})
+}
+
+// merge appends the field errors of err, if it is a ValidationError,
+// with their field names under prefix
+func (e *ValidationError) merge(prefix string, err error) {
+	var v ValidationError
+	if errors.As(err, &v) {
+		*e = append(*e, v.Prefix(prefix)...)
+	}
+}
+
+// err returns e as an error, or nil when it is empty
+func (e ValidationError) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Prefix returns a copy of e with prefix prepended to each field name
+func (e ValidationError) Prefix(prefix string) ValidationError {
+	out := make(ValidationError, len(e))
+	for i, f := range e {
+		out[i] = FieldError{Field: prefix + f.Field, Message: f.Message}
+	}
+	return out
+}
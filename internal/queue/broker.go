@@ -0,0 +1,172 @@
+package queue
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/facade"
+)
+
+// Message represents a queued task
+type Message struct {
+	Prompt    string                   `json:"prompt,omitempty"` // Single-turn prompt, used when Messages is empty
+	Messages  []facade.ChatMessage     `json:"messages,omitempty"`
+	TaskID    string                   `json:"task_id"`
+	Options   facade.GenerationOptions `json:"options,omitempty"`
+	Merge     facade.MergeOptions      `json:"merge,omitempty"`
+	Stream    bool                     `json:"stream,omitempty"`    // Publish token deltas while processing
+	Providers []string                 `json:"providers,omitempty"` // Subset of providers to call; empty for all
+	Callback  string                   `json:"callback,omitempty"`  // URL the worker POSTs the finished task to
+	Tenant    string                   `json:"tenant,omitempty"`    // Owner of the task, from the submitting API key
+}
+
+// Request returns the facade request for this task. Messages queued by
+// older producers carry only Prompt.
+func (m Message) Request() facade.Request {
+	msgs := m.Messages
+	if len(msgs) == 0 && m.Prompt != "" {
+		msgs = facade.PromptMessages("", m.Prompt)
+	}
+	return facade.Request{Messages: msgs, Options: m.Options, Merge: m.Merge, Providers: m.Providers}
+}
+
+// Fingerprint identifies the request m carries, ignoring its task ID, so
+// that resubmissions of the same request can be recognised
+func (m Message) Fingerprint() string {
+	m.TaskID = ""
+	data, _ := json.Marshal(m)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Queue backends selectable with QUEUE_BACKEND
+const (
+	BackendRabbitMQ = "rabbitmq"
+	BackendMemory   = "memory" // In-process; producers and workers must share one binary
+	BackendRedis    = "redis"  // Redis Streams with a consumer group
+)
+
+// Broker carries tasks from producers to workers
+type Broker interface {
+	// Publish enqueues a message, returning once the backend has it
+	Publish(msg Message) error
+	// Consume delivers messages until ctx is cancelled or the broker is
+	// closed, then closes the returned channel
+	Consume(ctx context.Context) (<-chan Delivery, error)
+	Close()
+}
+
+// Delivery is one consumed message. Exactly one of Ack, Retry, Release
+// or DeadLetter must be called to settle it.
+type Delivery interface {
+	Body() []byte
+	// Ack marks the message as processed
+	Ack() error
+	// Retry requeues the message with its delivery count incremented, or
+	// dead-letters it once the count reaches the maximum. deadLettered
+	// reports which happened.
+	Retry(reason string) (deadLettered bool, err error)
+	// Release requeues the message without counting a failed delivery,
+	// e.g. when a worker shuts down mid-task
+	Release() error
+	// DeadLetter parks a message that can never succeed, recording reason
+	DeadLetter(reason string) error
+}
+
+// DeadLetters is implemented by brokers whose dead-lettered messages
+// can be inspected and replayed
+type DeadLetters interface {
+	// InspectDeadLetters returns up to limit dead-lettered messages, oldest
+	// first, leaving them in place. limit <= 0 returns all of them.
+	InspectDeadLetters(limit int) ([]DeadLetter, error)
+	// ReplayDeadLetters requeues up to limit dead-lettered messages with a
+	// fresh delivery count. A non-empty taskID replays only that task.
+	// limit <= 0 replays every match. It returns the number replayed.
+	ReplayDeadLetters(limit int, taskID string) (int, error)
+}
+
+// DeadLetter is a message parked on the dead-letter queue
+type DeadLetter struct {
+	TaskID     string // Empty if the body is not a valid Message
+	Reason     string
+	FailedAt   time.Time
+	Deliveries int
+	Body       []byte
+}
+
+// Defaults for the zero values of Options
+const (
+	defaultMaxDeliveries     = 5
+	defaultReconnectDelay    = 1 * time.Second
+	defaultMaxReconnectDelay = 30 * time.Second
+	defaultConnectWait       = 5 * time.Second
+	defaultConfirmTimeout    = 5 * time.Second
+	defaultClaimIdle         = 5 * time.Minute
+)
+
+// Options tunes a broker; zero values select the defaults. Backends
+// ignore the settings that do not apply to them.
+type Options struct {
+	MaxDeliveries     int           // Deliveries per message before it is dead-lettered
+	ReconnectDelay    time.Duration // First delay between reconnection attempts
+	MaxReconnectDelay time.Duration // Cap on the doubling reconnection delay
+	ConnectWait       time.Duration // How long a publish waits for a reconnect before failing
+	ConfirmTimeout    time.Duration // How long a publish waits for the broker's confirm
+	Prefetch          int           // Unsettled deliveries a consumer may hold; 0 for the backend default
+	ClaimIdle         time.Duration // Redis: how long a delivery may stay unsettled before another consumer claims it
+}
+
+// withDefaults fills in the zero values of o
+func (o Options) withDefaults() Options {
+	if o.MaxDeliveries <= 0 {
+		o.MaxDeliveries = defaultMaxDeliveries
+	}
+	if o.ReconnectDelay <= 0 {
+		o.ReconnectDelay = defaultReconnectDelay
+	}
+	if o.MaxReconnectDelay <= 0 {
+		o.MaxReconnectDelay = defaultMaxReconnectDelay
+	}
+	if o.ConnectWait <= 0 {
+		o.ConnectWait = defaultConnectWait
+	}
+	if o.ConfirmTimeout <= 0 {
+		o.ConfirmTimeout = defaultConfirmTimeout
+	}
+	if o.ClaimIdle <= 0 {
+		o.ClaimIdle = defaultClaimIdle
+	}
+	return o
+}
+
+// New connects to the queue backend selected in cfg
+func New(cfg *facade.Config) (Broker, error) {
+	opts := OptionsFromConfig(cfg)
+	switch cfg.QueueBackend {
+	case BackendRabbitMQ:
+		return NewRabbitMQ(cfg.RABBITMQ_URL, opts)
+	case BackendMemory:
+		return NewMemory(opts), nil
+	case BackendRedis:
+		return NewRedisStreams(cfg.Redis_URL, opts)
+	}
+	return nil, fmt.Errorf("unknown queue backend %q", cfg.QueueBackend)
+}
+
+// OptionsFromConfig returns the queue options set in cfg
+func OptionsFromConfig(cfg *facade.Config) Options {
+	return Options{MaxDeliveries: cfg.MaxDeliveries, ConfirmTimeout: cfg.ConfirmTimeout, Prefetch: cfg.WorkerConcurrency}
+}
+
+// taskIDOf extracts the task ID from a message body, if it has one
+func taskIDOf(body []byte) string {
+	var msg Message
+	if json.Unmarshal(body, &msg) != nil {
+		return ""
+	}
+	return msg.TaskID
+}
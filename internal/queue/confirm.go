@@ -0,0 +1,166 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// ErrUnconfirmed is returned when the broker does not confirm a publish
+// in time, rejects it, or returns it as unroutable. The message may not
+// have been queued.
+var ErrUnconfirmed = errors.New("publish not confirmed by RabbitMQ")
+
+// publisher wraps a channel in confirm mode. One goroutine receives both
+// the mandatory returns and the confirms, so a return, which the broker
+// sends before the ack for the same message, is always recorded before
+// the publish it belongs to is settled.
+type publisher struct {
+	ch      *amqp091.Channel
+	timeout time.Duration // How long to wait for a confirm
+
+	send sync.Mutex // Serializes publishes so delivery tags match pending entries
+
+	mu       sync.Mutex
+	pending  map[uint64]*pendingPublish // Delivery tag -> publish awaiting its confirm
+	returned map[string]bool            // MessageIds the broker returned as unroutable
+}
+
+// pendingPublish is one publish waiting for the broker to settle it
+type pendingPublish struct {
+	id     string
+	key    string
+	result chan error // Receives the outcome once; buffered so the tracker never blocks
+}
+
+// newPublisher puts ch into confirm mode
+func newPublisher(ch *amqp091.Channel, timeout time.Duration) (*publisher, error) {
+	if err := ch.Confirm(false); err != nil {
+		return nil, fmt.Errorf("failed to enable publisher confirms: %v", err)
+	}
+	p := &publisher{
+		ch:       ch,
+		timeout:  timeout,
+		pending:  make(map[uint64]*pendingPublish),
+		returned: make(map[string]bool),
+	}
+	// Unbuffered, so the channel cannot dispatch an ack until track has
+	// taken any return that preceded it
+	confirms := ch.NotifyPublish(make(chan amqp091.Confirmation))
+	returns := ch.NotifyReturn(make(chan amqp091.Return))
+	go p.track(confirms, returns)
+	return p, nil
+}
+
+// track settles pending publishes from the channel's returns and confirms
+// until the channel closes, then fails whatever is still waiting
+func (p *publisher) track(confirms <-chan amqp091.Confirmation, returns <-chan amqp091.Return) {
+	for confirms != nil {
+		select {
+		case ret, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			p.mu.Lock()
+			if _, ok := p.returned[ret.MessageId]; ok {
+				p.returned[ret.MessageId] = true
+			}
+			p.mu.Unlock()
+		case conf, ok := <-confirms:
+			if !ok {
+				confirms = nil
+				continue
+			}
+			p.settle(conf)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for tag, pp := range p.pending {
+		pp.result <- fmt.Errorf("%w: channel closed", ErrUnconfirmed)
+		delete(p.pending, tag)
+		delete(p.returned, pp.id)
+	}
+}
+
+// settle reports the outcome of the publish conf belongs to
+func (p *publisher) settle(conf amqp091.Confirmation) {
+	p.mu.Lock()
+	pp, ok := p.pending[conf.DeliveryTag]
+	returned := ok && p.returned[pp.id]
+	if ok {
+		delete(p.pending, conf.DeliveryTag)
+		delete(p.returned, pp.id)
+	}
+	p.mu.Unlock()
+	if !ok {
+		return // The publish already gave up waiting
+	}
+
+	switch {
+	case !conf.Ack:
+		pp.result <- fmt.Errorf("%w: broker nacked the message", ErrUnconfirmed)
+	case returned:
+		pp.result <- fmt.Errorf("%w: no queue bound for %q", ErrUnconfirmed, pp.key)
+	default:
+		pp.result <- nil
+	}
+}
+
+// forget drops a publish that will not wait for its confirm
+func (p *publisher) forget(tag uint64, id string) {
+	p.mu.Lock()
+	delete(p.pending, tag)
+	delete(p.returned, id)
+	p.mu.Unlock()
+}
+
+// publish sends a persistent, mandatory message and waits for the broker
+// to confirm it
+func (p *publisher) publish(exchange, key string, body []byte, headers amqp091.Table) error {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	pp := &pendingPublish{id: uuid.New().String(), key: key, result: make(chan error, 1)}
+	p.send.Lock()
+	tag := p.ch.GetNextPublishSeqNo()
+	p.mu.Lock()
+	p.pending[tag] = pp
+	p.returned[pp.id] = false
+	p.mu.Unlock()
+	err := p.ch.PublishWithContext(
+		ctx,
+		exchange, // Exchange
+		key,      // Routing key
+		true,     // Mandatory: return the message if no queue is bound
+		false,    // Immediate
+		amqp091.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp091.Persistent,
+			MessageId:    pp.id,
+			Timestamp:    time.Now(),
+			Headers:      headers,
+			Body:         body,
+		},
+	)
+	p.send.Unlock()
+	if err != nil {
+		p.forget(tag, pp.id)
+		return fmt.Errorf("publish error: %v", err)
+	}
+
+	select {
+	case err := <-pp.result:
+		return err
+	case <-ctx.Done():
+		p.forget(tag, pp.id)
+		return fmt.Errorf("%w: no confirm within %v", ErrUnconfirmed, p.timeout)
+	}
+}
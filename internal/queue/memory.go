@@ -0,0 +1,161 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// memoryQueueSize bounds the in-process queue; Publish fails when it is full
+const memoryQueueSize = 1024
+
+// memoryItem is a queued body with its failed delivery count
+type memoryItem struct {
+	body       []byte
+	deliveries int
+}
+
+// Memory is an in-process Broker backed by a channel. Tasks are lost when
+// the process exits, so it suits single-binary deployments and tests.
+type Memory struct {
+	opts  Options
+	items chan memoryItem
+
+	mu          sync.Mutex
+	deadLetters []DeadLetter
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewMemory creates an empty in-process broker
+func NewMemory(opts Options) *Memory {
+	return &Memory{opts: opts.withDefaults(), items: make(chan memoryItem, memoryQueueSize), done: make(chan struct{})}
+}
+
+// Publish enqueues a message, failing if the queue is full
+func (m *Memory) Publish(msg Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal error: %v", err)
+	}
+	return m.enqueue(memoryItem{body: body})
+}
+
+func (m *Memory) enqueue(item memoryItem) error {
+	select {
+	case <-m.done:
+		return fmt.Errorf("queue is closed")
+	default:
+	}
+	select {
+	case m.items <- item:
+		return nil
+	default:
+		return fmt.Errorf("queue is full (%d messages)", memoryQueueSize)
+	}
+}
+
+// Consume delivers queued messages until ctx is cancelled or the broker
+// is closed. Several consumers share the queue.
+func (m *Memory) Consume(ctx context.Context) (<-chan Delivery, error) {
+	out := make(chan Delivery)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-m.done:
+				return
+			case item := <-m.items:
+				select {
+				case out <- &memoryDelivery{m: m, item: item}:
+				case <-ctx.Done():
+					// Taken from the queue a moment ago, so there is room for it
+					_ = m.enqueue(item)
+					return
+				case <-m.done:
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+// Close stops consumers; queued messages are discarded
+func (m *Memory) Close() {
+	m.closeOnce.Do(func() { close(m.done) })
+}
+
+// InspectDeadLetters returns up to limit dead-lettered messages, oldest first
+func (m *Memory) InspectDeadLetters(limit int) ([]DeadLetter, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := len(m.deadLetters)
+	if limit > 0 && limit < n {
+		n = limit
+	}
+	return append([]DeadLetter(nil), m.deadLetters[:n]...), nil
+}
+
+// ReplayDeadLetters requeues up to limit dead-lettered messages, or only
+// those for taskID when it is set
+func (m *Memory) ReplayDeadLetters(limit int, taskID string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	replayed := 0
+	kept := m.deadLetters[:0]
+	for _, dl := range m.deadLetters {
+		if (limit > 0 && replayed >= limit) || (taskID != "" && dl.TaskID != taskID) {
+			kept = append(kept, dl)
+			continue
+		}
+		if err := m.enqueue(memoryItem{body: dl.Body}); err != nil {
+			kept = append(kept, dl)
+			m.deadLetters = kept
+			return replayed, err
+		}
+		replayed++
+	}
+	m.deadLetters = kept
+	return replayed, nil
+}
+
+// memoryDelivery settles an in-process delivery
+type memoryDelivery struct {
+	m    *Memory
+	item memoryItem
+}
+
+func (d *memoryDelivery) Body() []byte   { return d.item.body }
+func (d *memoryDelivery) Ack() error     { return nil }
+func (d *memoryDelivery) Release() error { return d.m.enqueue(d.item) }
+
+func (d *memoryDelivery) Retry(reason string) (bool, error) {
+	count := d.item.deliveries + 1
+	if count >= d.m.opts.MaxDeliveries {
+		return true, d.deadLetter(count, fmt.Sprintf("%s (after %d deliveries)", reason, count))
+	}
+	return false, d.m.enqueue(memoryItem{body: d.item.body, deliveries: count})
+}
+
+func (d *memoryDelivery) DeadLetter(reason string) error {
+	return d.deadLetter(d.item.deliveries+1, reason)
+}
+
+func (d *memoryDelivery) deadLetter(count int, reason string) error {
+	d.m.mu.Lock()
+	defer d.m.mu.Unlock()
+	d.m.deadLetters = append(d.m.deadLetters, DeadLetter{
+		TaskID:     taskIDOf(d.item.body),
+		Reason:     reason,
+		FailedAt:   time.Now(),
+		Deliveries: count,
+		Body:       d.item.body,
+	})
+	return nil
+}
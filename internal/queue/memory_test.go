@@ -0,0 +1,113 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// next waits for the next delivery
+func next(t *testing.T, deliveries <-chan Delivery) Delivery {
+	t.Helper()
+	select {
+	case d, ok := <-deliveries:
+		if !ok {
+			t.Fatal("deliveries closed")
+		}
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("no delivery")
+	}
+	return nil
+}
+
+// consume starts a consumer that stops when the test ends
+func consume(t *testing.T, b Broker) <-chan Delivery {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	deliveries, err := b.Consume(ctx)
+	if err != nil {
+		t.Fatalf("Consume: %v", err)
+	}
+	return deliveries
+}
+
+func TestMemoryAckAndRelease(t *testing.T) {
+	m := NewMemory(Options{MaxDeliveries: 2})
+	defer m.Close()
+	deliveries := consume(t, m)
+
+	if err := m.Publish(Message{TaskID: "t1", Prompt: "hi"}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if err := next(t, deliveries).Release(); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	// A release does not count as a failed delivery, so one retry is left
+	d := next(t, deliveries)
+	if taskIDOf(d.Body()) != "t1" {
+		t.Fatalf("body = %s", d.Body())
+	}
+	if dead, err := d.Retry("provider down"); dead || err != nil {
+		t.Fatalf("Retry = %v, %v; want requeued", dead, err)
+	}
+	if err := next(t, deliveries).Ack(); err != nil {
+		t.Fatalf("Ack: %v", err)
+	}
+
+	select {
+	case d := <-deliveries:
+		t.Fatalf("acked message delivered again: %s", d.Body())
+	case <-time.After(50 * time.Millisecond):
+	}
+	if letters, _ := m.InspectDeadLetters(0); len(letters) != 0 {
+		t.Fatalf("dead letters = %+v", letters)
+	}
+}
+
+func TestMemoryRetryAndDeadLetter(t *testing.T) {
+	m := NewMemory(Options{MaxDeliveries: 3})
+	defer m.Close()
+	deliveries := consume(t, m)
+
+	if err := m.Publish(Message{TaskID: "t1", Prompt: "hi"}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	for attempt := 1; attempt <= 3; attempt++ {
+		dead, err := next(t, deliveries).Retry("provider down")
+		if err != nil {
+			t.Fatalf("attempt %d: Retry: %v", attempt, err)
+		}
+		if dead != (attempt == 3) {
+			t.Fatalf("attempt %d: dead-lettered = %v", attempt, dead)
+		}
+	}
+
+	letters, err := m.InspectDeadLetters(0)
+	if err != nil {
+		t.Fatalf("InspectDeadLetters: %v", err)
+	}
+	if len(letters) != 1 || letters[0].TaskID != "t1" || letters[0].Deliveries != 3 ||
+		letters[0].Reason != "provider down (after 3 deliveries)" {
+		t.Fatalf("dead letters = %+v", letters)
+	}
+
+	if n, err := m.ReplayDeadLetters(0, "other"); n != 0 || err != nil {
+		t.Fatalf("replay of another task = %d, %v", n, err)
+	}
+	if n, err := m.ReplayDeadLetters(0, "t1"); n != 1 || err != nil {
+		t.Fatalf("ReplayDeadLetters = %d, %v", n, err)
+	}
+	// A replayed message starts over with a fresh delivery count
+	if dead, err := next(t, deliveries).Retry("still down"); dead || err != nil {
+		t.Fatalf("Retry after replay = %v, %v; want requeued", dead, err)
+	}
+	if err := next(t, deliveries).DeadLetter("invalid request"); err != nil {
+		t.Fatalf("DeadLetter: %v", err)
+	}
+	letters, _ = m.InspectDeadLetters(0)
+	if len(letters) != 1 || letters[0].Reason != "invalid request" || letters[0].Deliveries != 2 {
+		t.Fatalf("dead letters = %+v", letters)
+	}
+}
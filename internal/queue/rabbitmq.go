@@ -1,53 +1,212 @@
 package queue
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"sync"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/rabbitmq/amqp091-go"
 )
 
-// Message represents a queued task
-type Message struct {
-	Prompt string `json:"prompt"`
-	TaskID string `json:"task_id"`
-}
+// Queue topology. Poison messages are published to the dead-letter
+// exchange, which routes them to the dead-letter queue.
+const (
+	RequestQueue       = "ai_requests"
+	DeadLetterExchange = "ai_requests.dlx"
+	DeadLetterQueue    = "ai_requests.dlq"
+)
+
+// Headers recorded on retried and dead-lettered messages
+const (
+	HeaderDeliveryCount = "x-delivery-count" // Deliveries that ended without success
+	HeaderFailureReason = "x-failure-reason"
+	HeaderFailedAt      = "x-failed-at" // RFC 3339 time the message was dead-lettered
+)
 
-// RabbitMQ manages queue connections
+// ErrNotConnected is returned when the broker stays unreachable for
+// longer than Options.ConnectWait
+var ErrNotConnected = errors.New("RabbitMQ connection unavailable")
+
+// RabbitMQ manages a supervised queue connection. When the broker drops
+// the connection it is re-dialled with backoff, the topology is
+// redeclared and consumers resume on the new channel.
 type RabbitMQ struct {
-	conn    *amqp091.Connection
-	channel *amqp091.Channel
-	queue   amqp091.Queue
+	url  string
+	opts Options
+
+	mu        sync.RWMutex
+	conn      *amqp091.Connection
+	pub       *publisher    // Confirm-mode channel, also used for consuming
+	connected chan struct{} // Closed while conn and pub are usable
+
+	done      chan struct{} // Closed by Close
+	closeOnce sync.Once
 }
 
-// NewRabbitMQ initializes a RabbitMQ connection
-func NewRabbitMQ(url string) (*RabbitMQ, error) {
-	conn, err := amqp091.Dial(url)
+// NewRabbitMQ initializes a RabbitMQ connection. The first dial must
+// succeed; later connection losses are recovered in the background.
+func NewRabbitMQ(url string, opts Options) (*RabbitMQ, error) {
+	opts = opts.withDefaults()
+	r := &RabbitMQ{url: url, opts: opts, connected: make(chan struct{}), done: make(chan struct{})}
+	if err := r.connect(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// connect dials the broker, declares the topology and starts watching
+// the new connection
+func (r *RabbitMQ) connect() error {
+	conn, err := amqp091.Dial(r.url)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to RabbitMQ: %v", err)
+		return fmt.Errorf("failed to connect to RabbitMQ: %v", err)
 	}
 
 	ch, err := conn.Channel()
 	if err != nil {
 		conn.Close()
-		return nil, fmt.Errorf("failed to open channel: %v", err)
+		return fmt.Errorf("failed to open channel: %v", err)
 	}
 
-	q, err := ch.QueueDeclare(
-		"ai_requests", // Queue name
-		true,          // Durable
-		false,         // Auto-delete
-		false,         // Exclusive
-		false,         // No-wait
-		nil,           // Args
-	)
+	if err := declareTopology(ch); err != nil {
+		ch.Close()
+		conn.Close()
+		return err
+	}
+
+	pub, err := newPublisher(ch, r.opts.ConfirmTimeout)
 	if err != nil {
 		ch.Close()
 		conn.Close()
-		return nil, fmt.Errorf("failed to declare queue: %v", err)
+		return err
+	}
+
+	if r.opts.Prefetch > 0 {
+		if err := ch.Qos(r.opts.Prefetch, 0, false); err != nil {
+			ch.Close()
+			conn.Close()
+			return fmt.Errorf("failed to set prefetch: %v", err)
+		}
 	}
 
-	return &RabbitMQ{conn: conn, channel: ch, queue: q}, nil
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	select {
+	case <-r.done:
+		// Closed while we were reconnecting
+		conn.Close()
+		return fmt.Errorf("RabbitMQ is closed")
+	default:
+	}
+	r.conn, r.pub = conn, pub
+	close(r.connected)
+	// NotifyClose must be registered before the lock is released, or a
+	// close racing with Close could go unseen
+	connClosed := conn.NotifyClose(make(chan *amqp091.Error, 1))
+	chClosed := ch.NotifyClose(make(chan *amqp091.Error, 1))
+	go r.watch(conn, connClosed, chClosed)
+	return nil
+}
+
+// watch waits for the connection or channel to close, then reconnects
+// unless the RabbitMQ itself was closed
+func (r *RabbitMQ) watch(conn *amqp091.Connection, connClosed, chClosed <-chan *amqp091.Error) {
+	var reason *amqp091.Error
+	select {
+	case reason = <-connClosed:
+	case reason = <-chClosed:
+	case <-r.done:
+		return
+	}
+
+	r.mu.Lock()
+	r.connected = make(chan struct{})
+	r.mu.Unlock()
+	// A channel-level error leaves the connection open; drop it too
+	conn.Close()
+
+	select {
+	case <-r.done:
+		return
+	default:
+	}
+	log.Printf("RabbitMQ connection lost: %v; reconnecting", reason)
+
+	delay := r.opts.ReconnectDelay
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-time.After(delay):
+		}
+		err := r.connect()
+		if err == nil {
+			log.Printf("RabbitMQ reconnected")
+			return
+		}
+		log.Printf("RabbitMQ reconnect failed, retrying in %v: %v", delay, err)
+		delay = min(delay*2, r.opts.MaxReconnectDelay)
+	}
+}
+
+// session returns the live connection and its publishing channel,
+// waiting up to wait for a reconnect. wait <= 0 waits until the RabbitMQ
+// is closed.
+func (r *RabbitMQ) session(wait time.Duration) (*amqp091.Connection, *publisher, error) {
+	var timeout <-chan time.Time
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	for {
+		r.mu.RLock()
+		conn, pub, connected := r.conn, r.pub, r.connected
+		r.mu.RUnlock()
+		select {
+		case <-connected:
+			return conn, pub, nil
+		default:
+		}
+		select {
+		case <-connected:
+		case <-timeout:
+			return nil, nil, ErrNotConnected
+		case <-r.done:
+			return nil, nil, fmt.Errorf("RabbitMQ is closed")
+		}
+	}
+}
+
+// declareTopology declares the request queue and its dead-letter
+// exchange and queue
+func declareTopology(ch *amqp091.Channel) error {
+	_, err := ch.QueueDeclare(
+		RequestQueue, // Queue name
+		true,         // Durable
+		false,        // Auto-delete
+		false,        // Exclusive
+		false,        // No-wait
+		nil,          // Args
+	)
+	if err != nil {
+		return fmt.Errorf("failed to declare queue: %v", err)
+	}
+	if err := ch.ExchangeDeclare(DeadLetterExchange, amqp091.ExchangeDirect, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare dead-letter exchange: %v", err)
+	}
+	if _, err := ch.QueueDeclare(DeadLetterQueue, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare dead-letter queue: %v", err)
+	}
+	if err := ch.QueueBind(DeadLetterQueue, RequestQueue, DeadLetterExchange, false, nil); err != nil {
+		return fmt.Errorf("failed to bind dead-letter queue: %v", err)
+	}
+	return nil
 }
 
 // Publish sends a message to the queue
@@ -56,29 +215,94 @@ func (r *RabbitMQ) Publish(msg Message) error {
 	if err != nil {
 		return fmt.Errorf("marshal error: %v", err)
 	}
+	return r.publish("", RequestQueue, body, nil)
+}
 
-	err = r.channel.Publish(
-		"",           // Exchange
-		r.queue.Name, // Routing key (queue name)
-		false,        // Mandatory
-		false,        // Immediate
-		amqp091.Publishing{
-			ContentType: "application/json",
-			Body:        body,
-		},
-	)
+// publish sends a raw body with headers to exchange under key on the
+// current channel, waiting briefly if the connection is being recovered
+func (r *RabbitMQ) publish(exchange, key string, body []byte, headers amqp091.Table) error {
+	_, pub, err := r.session(r.opts.ConnectWait)
 	if err != nil {
-		return fmt.Errorf("publish error: %v", err)
+		return err
 	}
-	return nil
+	return pub.publish(exchange, key, body, headers)
 }
 
-// Consume starts consuming messages from the queue
-func (r *RabbitMQ) Consume() (<-chan amqp091.Delivery, error) {
-	msgs, err := r.channel.Consume(
-		r.queue.Name, // Queue
-		"",           // Consumer tag
-		true,         // Auto-ack (set to false for manual ack in production)
+// Consume starts consuming messages from the queue. The returned channel
+// survives reconnects. Cancelling ctx stops the broker sending more; the
+// channel is closed once deliveries already prefetched have been handed
+// over, or when the RabbitMQ is closed.
+func (r *RabbitMQ) Consume(ctx context.Context) (<-chan Delivery, error) {
+	tag := "ai-worker-" + uuid.New().String()
+	_, pub, err := r.session(r.opts.ConnectWait)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := consumeOn(pub.ch, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan Delivery)
+	go func() {
+		defer close(out)
+		stop := ctx.Done()
+		for {
+			select {
+			case <-stop:
+				if err := pub.ch.Cancel(tag, false); err != nil {
+					log.Printf("Failed to cancel consumer: %v", err)
+				}
+				stop = nil
+			case d, ok := <-msgs:
+				if ok {
+					select {
+					case out <- &rabbitDelivery{r: r, d: d}:
+					case <-r.done:
+						return
+					}
+					continue
+				}
+				if ctx.Err() != nil {
+					return
+				}
+				// The channel closed; resume once the connection is recovered
+				if pub, msgs = r.resume(tag); msgs == nil {
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+// resume re-registers consumer tag once a connection is available. It
+// returns nil deliveries if the RabbitMQ was closed first.
+func (r *RabbitMQ) resume(tag string) (*publisher, <-chan amqp091.Delivery) {
+	for {
+		_, pub, err := r.session(0)
+		if err != nil {
+			return nil, nil
+		}
+		msgs, err := consumeOn(pub.ch, tag)
+		if err == nil {
+			return pub, msgs
+		}
+		log.Printf("Failed to resume consumer: %v", err)
+		select {
+		case <-r.done:
+			return nil, nil
+		case <-time.After(r.opts.ReconnectDelay):
+		}
+	}
+}
+
+// consumeOn registers a manual-ack consumer for the request queue on ch
+func consumeOn(ch *amqp091.Channel, tag string) (<-chan amqp091.Delivery, error) {
+	msgs, err := ch.Consume(
+		RequestQueue, // Queue
+		tag,          // Consumer tag
+		false,        // Auto-ack
 		false,        // Exclusive
 		false,        // No-local
 		false,        // No-wait
@@ -90,8 +314,165 @@ func (r *RabbitMQ) Consume() (<-chan amqp091.Delivery, error) {
 	return msgs, nil
 }
 
-// Close shuts down the RabbitMQ connection
+// rabbitDelivery settles an AMQP delivery. Retries and releases are
+// republished, with confirms, before the original is acked.
+type rabbitDelivery struct {
+	r *RabbitMQ
+	d amqp091.Delivery
+}
+
+func (d *rabbitDelivery) Body() []byte { return d.d.Body }
+
+func (d *rabbitDelivery) Ack() error {
+	if err := d.d.Ack(false); err != nil {
+		return fmt.Errorf("ack error: %v", err)
+	}
+	return nil
+}
+
+func (d *rabbitDelivery) Retry(reason string) (bool, error) {
+	count := deliveryCount(d.d) + 1
+	if count >= d.r.opts.MaxDeliveries {
+		return true, d.deadLetter(count, fmt.Sprintf("%s (after %d deliveries)", reason, count))
+	}
+	headers := copyHeaders(d.d.Headers)
+	headers[HeaderDeliveryCount] = int64(count)
+	headers[HeaderFailureReason] = reason
+	if err := d.r.publish("", RequestQueue, d.d.Body, headers); err != nil {
+		return false, err
+	}
+	return false, d.Ack()
+}
+
+func (d *rabbitDelivery) Release() error {
+	if err := d.r.publish("", RequestQueue, d.d.Body, copyHeaders(d.d.Headers)); err != nil {
+		return err
+	}
+	return d.Ack()
+}
+
+func (d *rabbitDelivery) DeadLetter(reason string) error {
+	return d.deadLetter(deliveryCount(d.d)+1, reason)
+}
+
+func (d *rabbitDelivery) deadLetter(count int, reason string) error {
+	headers := copyHeaders(d.d.Headers)
+	headers[HeaderDeliveryCount] = int64(count)
+	headers[HeaderFailureReason] = reason
+	headers[HeaderFailedAt] = time.Now().UTC().Format(time.RFC3339)
+	if err := d.r.publish(DeadLetterExchange, RequestQueue, d.d.Body, headers); err != nil {
+		return err
+	}
+	return d.Ack()
+}
+
+// InspectDeadLetters returns up to limit dead-lettered messages, oldest
+// first, leaving them on the queue. limit <= 0 returns all of them.
+func (r *RabbitMQ) InspectDeadLetters(limit int) ([]DeadLetter, error) {
+	conn, _, err := r.session(r.opts.ConnectWait)
+	if err != nil {
+		return nil, err
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open channel: %v", err)
+	}
+	// Closing the channel requeues every message we fetched
+	defer ch.Close()
+
+	var letters []DeadLetter
+	for limit <= 0 || len(letters) < limit {
+		d, ok, err := ch.Get(DeadLetterQueue, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read dead-letter queue: %v", err)
+		}
+		if !ok {
+			break
+		}
+		letters = append(letters, toDeadLetter(d))
+	}
+	return letters, nil
+}
+
+// ReplayDeadLetters moves up to limit dead-lettered messages back onto the
+// request queue with a fresh delivery count. A non-empty taskID replays
+// only that task. limit <= 0 replays every match. It returns the number
+// of messages replayed.
+func (r *RabbitMQ) ReplayDeadLetters(limit int, taskID string) (int, error) {
+	conn, _, err := r.session(r.opts.ConnectWait)
+	if err != nil {
+		return 0, err
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		return 0, fmt.Errorf("failed to open channel: %v", err)
+	}
+	// Skipped messages stay unacked until the channel closes, which
+	// requeues them and keeps Get from returning them twice
+	defer ch.Close()
+
+	replayed := 0
+	for limit <= 0 || replayed < limit {
+		d, ok, err := ch.Get(DeadLetterQueue, false)
+		if err != nil {
+			return replayed, fmt.Errorf("failed to read dead-letter queue: %v", err)
+		}
+		if !ok {
+			break
+		}
+		if taskID != "" && taskIDOf(d.Body) != taskID {
+			continue
+		}
+		if err := r.publish("", RequestQueue, d.Body, nil); err != nil {
+			return replayed, err
+		}
+		if err := d.Ack(false); err != nil {
+			return replayed, fmt.Errorf("ack error: %v", err)
+		}
+		replayed++
+	}
+	return replayed, nil
+}
+
+// deliveryCount returns how many earlier deliveries of d failed
+func deliveryCount(d amqp091.Delivery) int {
+	switch n := d.Headers[HeaderDeliveryCount].(type) {
+	case int64:
+		return int(n)
+	case int32:
+		return int(n)
+	case int:
+		return n
+	}
+	return 0
+}
+
+// copyHeaders returns a writable copy of a delivery's headers
+func copyHeaders(h amqp091.Table) amqp091.Table {
+	headers := make(amqp091.Table, len(h)+3)
+	for k, v := range h {
+		headers[k] = v
+	}
+	return headers
+}
+
+// toDeadLetter decodes the failure headers of a dead-lettered delivery
+func toDeadLetter(d amqp091.Delivery) DeadLetter {
+	dl := DeadLetter{TaskID: taskIDOf(d.Body), Deliveries: deliveryCount(d), Body: d.Body}
+	dl.Reason, _ = d.Headers[HeaderFailureReason].(string)
+	if at, ok := d.Headers[HeaderFailedAt].(string); ok {
+		dl.FailedAt, _ = time.Parse(time.RFC3339, at)
+	}
+	return dl
+}
+
+// Close shuts down the RabbitMQ connection and stops reconnecting
 func (r *RabbitMQ) Close() {
-	r.channel.Close()
-	r.conn.Close()
+	r.closeOnce.Do(func() {
+		close(r.done)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.pub.ch.Close()
+		r.conn.Close()
+	})
 }
@@ -0,0 +1,270 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis Streams layout. Tasks are entries in requestStream, read through
+// the consumerGroup; dead-lettered entries are moved to deadLetterStream.
+const (
+	requestStream    = "queue:ai_requests"
+	deadLetterStream = "queue:ai_requests:dlq"
+	consumerGroup    = "workers"
+)
+
+// How long one XREADGROUP blocks, which bounds how quickly a cancelled
+// consumer notices
+const streamBlock = 2 * time.Second
+
+// RedisStreams is a Broker backed by a Redis stream and consumer group.
+// Entries left unacknowledged by a crashed consumer are claimed by
+// another one after Options.ClaimIdle.
+type RedisStreams struct {
+	client *redis.Client
+	opts   Options
+	ctx    context.Context
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewRedisStreams connects to Redis and creates the consumer group if needed
+func NewRedisStreams(url string, opts Options) (*RedisStreams, error) {
+	opt, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Redis URL: %v", err)
+	}
+	client := redis.NewClient(opt)
+	ctx := context.Background()
+	err = client.XGroupCreateMkStream(ctx, requestStream, consumerGroup, "0").Err()
+	if err != nil && !redis.HasErrorPrefix(err, "BUSYGROUP") {
+		client.Close()
+		return nil, fmt.Errorf("failed to create consumer group: %v", err)
+	}
+	return &RedisStreams{client: client, opts: opts.withDefaults(), ctx: ctx, done: make(chan struct{})}, nil
+}
+
+// Publish appends a message to the request stream
+func (r *RedisStreams) Publish(msg Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal error: %v", err)
+	}
+	if err := r.client.XAdd(r.ctx, entryArgs(requestStream, body, 0, "")).Err(); err != nil {
+		return fmt.Errorf("publish error: %v", err)
+	}
+	return nil
+}
+
+// Consume reads new entries for the consumer group, periodically claiming
+// entries that other consumers left idle for longer than ClaimIdle
+func (r *RedisStreams) Consume(ctx context.Context) (<-chan Delivery, error) {
+	consumer := "ai-worker-" + uuid.New().String()
+	count := int64(r.opts.Prefetch)
+	if count <= 0 {
+		count = 1
+	}
+
+	out := make(chan Delivery)
+	go func() {
+		defer close(out)
+		var lastClaim time.Time
+		for ctx.Err() == nil {
+			var entries []redis.XMessage
+			var err error
+			if time.Since(lastClaim) >= r.opts.ClaimIdle/2 {
+				lastClaim = time.Now()
+				entries, _, err = r.client.XAutoClaim(r.ctx, &redis.XAutoClaimArgs{
+					Stream: requestStream, Group: consumerGroup, Consumer: consumer,
+					MinIdle: r.opts.ClaimIdle, Start: "0-0", Count: count,
+				}).Result()
+			}
+			if err == nil && len(entries) == 0 {
+				var streams []redis.XStream
+				streams, err = r.client.XReadGroup(r.ctx, &redis.XReadGroupArgs{
+					Group: consumerGroup, Consumer: consumer,
+					Streams: []string{requestStream, ">"}, Count: count, Block: streamBlock,
+				}).Result()
+				if len(streams) > 0 {
+					entries = streams[0].Messages
+				}
+			}
+			if err != nil && err != redis.Nil {
+				log.Printf("Failed to read from Redis stream: %v", err)
+				select {
+				case <-r.done:
+					return
+				case <-time.After(r.opts.ReconnectDelay):
+				}
+				continue
+			}
+			// Entries already read belong to this consumer, so hand them
+			// all over even if ctx was cancelled meanwhile
+			for _, entry := range entries {
+				d := &streamDelivery{r: r, entry: entry}
+				select {
+				case out <- d:
+				case <-r.done:
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+// Close closes the Redis connection
+func (r *RedisStreams) Close() {
+	r.closeOnce.Do(func() {
+		close(r.done)
+		r.client.Close()
+	})
+}
+
+// InspectDeadLetters returns up to limit dead-lettered entries, oldest first
+func (r *RedisStreams) InspectDeadLetters(limit int) ([]DeadLetter, error) {
+	entries, err := r.deadLetterEntries(limit)
+	if err != nil {
+		return nil, err
+	}
+	letters := make([]DeadLetter, 0, len(entries))
+	for _, entry := range entries {
+		letters = append(letters, toStreamDeadLetter(entry))
+	}
+	return letters, nil
+}
+
+// ReplayDeadLetters moves up to limit dead-lettered entries, or only those
+// for taskID when it is set, back onto the request stream
+func (r *RedisStreams) ReplayDeadLetters(limit int, taskID string) (int, error) {
+	entries, err := r.deadLetterEntries(0)
+	if err != nil {
+		return 0, err
+	}
+	replayed := 0
+	for _, entry := range entries {
+		if limit > 0 && replayed >= limit {
+			break
+		}
+		body := entryBody(entry)
+		if taskID != "" && taskIDOf(body) != taskID {
+			continue
+		}
+		_, err := r.client.TxPipelined(r.ctx, func(pipe redis.Pipeliner) error {
+			pipe.XAdd(r.ctx, entryArgs(requestStream, body, 0, ""))
+			pipe.XDel(r.ctx, deadLetterStream, entry.ID)
+			return nil
+		})
+		if err != nil {
+			return replayed, fmt.Errorf("failed to replay %s: %v", entry.ID, err)
+		}
+		replayed++
+	}
+	return replayed, nil
+}
+
+func (r *RedisStreams) deadLetterEntries(limit int) ([]redis.XMessage, error) {
+	var entries []redis.XMessage
+	var err error
+	if limit > 0 {
+		entries, err = r.client.XRangeN(r.ctx, deadLetterStream, "-", "+", int64(limit)).Result()
+	} else {
+		entries, err = r.client.XRange(r.ctx, deadLetterStream, "-", "+").Result()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dead-letter stream: %v", err)
+	}
+	return entries, nil
+}
+
+// streamDelivery settles a stream entry. Each settlement acknowledges and
+// deletes the entry in the same transaction that requeues or
+// dead-letters it.
+type streamDelivery struct {
+	r     *RedisStreams
+	entry redis.XMessage
+}
+
+func (d *streamDelivery) Body() []byte { return entryBody(d.entry) }
+
+func (d *streamDelivery) Ack() error {
+	return d.settle(nil)
+}
+
+func (d *streamDelivery) Retry(reason string) (bool, error) {
+	count := entryDeliveries(d.entry) + 1
+	if count >= d.r.opts.MaxDeliveries {
+		return true, d.deadLetter(count, fmt.Sprintf("%s (after %d deliveries)", reason, count))
+	}
+	return false, d.settle(entryArgs(requestStream, d.Body(), count, reason))
+}
+
+func (d *streamDelivery) Release() error {
+	return d.settle(entryArgs(requestStream, d.Body(), entryDeliveries(d.entry), ""))
+}
+
+func (d *streamDelivery) DeadLetter(reason string) error {
+	return d.deadLetter(entryDeliveries(d.entry)+1, reason)
+}
+
+func (d *streamDelivery) deadLetter(count int, reason string) error {
+	args := entryArgs(deadLetterStream, d.Body(), count, reason)
+	args.Values = append(args.Values.([]interface{}), "failed_at", time.Now().UTC().Format(time.RFC3339))
+	return d.settle(args)
+}
+
+// settle acknowledges and deletes the entry, first adding next if set
+func (d *streamDelivery) settle(next *redis.XAddArgs) error {
+	ctx := d.r.ctx
+	_, err := d.r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if next != nil {
+			pipe.XAdd(ctx, next)
+		}
+		pipe.XAck(ctx, requestStream, consumerGroup, d.entry.ID)
+		pipe.XDel(ctx, requestStream, d.entry.ID)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to settle %s: %v", d.entry.ID, err)
+	}
+	return nil
+}
+
+// entryArgs builds a stream entry holding body and its delivery history
+func entryArgs(stream string, body []byte, deliveries int, reason string) *redis.XAddArgs {
+	values := []interface{}{"body", body, "deliveries", deliveries}
+	if reason != "" {
+		values = append(values, "reason", reason)
+	}
+	return &redis.XAddArgs{Stream: stream, Values: values}
+}
+
+func entryBody(entry redis.XMessage) []byte {
+	body, _ := entry.Values["body"].(string)
+	return []byte(body)
+}
+
+func entryDeliveries(entry redis.XMessage) int {
+	s, _ := entry.Values["deliveries"].(string)
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+func toStreamDeadLetter(entry redis.XMessage) DeadLetter {
+	body := entryBody(entry)
+	dl := DeadLetter{TaskID: taskIDOf(body), Deliveries: entryDeliveries(entry), Body: body}
+	dl.Reason, _ = entry.Values["reason"].(string)
+	if at, ok := entry.Values["failed_at"].(string); ok {
+		dl.FailedAt, _ = time.Parse(time.RFC3339, at)
+	}
+	return dl
+}
@@ -0,0 +1,126 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestStreams(t *testing.T, opts Options) (*RedisStreams, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	r, err := NewRedisStreams("redis://"+mr.Addr(), opts)
+	if err != nil {
+		t.Fatalf("NewRedisStreams: %v", err)
+	}
+	t.Cleanup(r.Close)
+	return r, mr
+}
+
+func TestRedisStreamsReclaimsIdleEntries(t *testing.T) {
+	r, mr := newTestStreams(t, Options{ClaimIdle: time.Minute})
+	ctx := context.Background()
+
+	if err := r.Publish(Message{TaskID: "orphan", Prompt: "hi"}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	// A consumer reads the entry and dies without settling it
+	_, err := r.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group: consumerGroup, Consumer: "crashed", Streams: []string{requestStream, ">"}, Count: 1,
+	}).Result()
+	if err != nil {
+		t.Fatalf("XReadGroup: %v", err)
+	}
+	if err := r.Publish(Message{TaskID: "fresh", Prompt: "hi"}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	mr.SetTime(time.Now().Add(2 * time.Minute))
+
+	deliveries := consume(t, r)
+	got := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		d := next(t, deliveries)
+		got[taskIDOf(d.Body())] = true
+		if err := d.Ack(); err != nil {
+			t.Fatalf("Ack: %v", err)
+		}
+	}
+	if !got["orphan"] || !got["fresh"] {
+		t.Fatalf("delivered %v, want the orphaned and the fresh entry", got)
+	}
+
+	pending, err := r.client.XPending(ctx, requestStream, consumerGroup).Result()
+	if err != nil {
+		t.Fatalf("XPending: %v", err)
+	}
+	if pending.Count != 0 {
+		t.Fatalf("%d entries still pending", pending.Count)
+	}
+	if n := r.client.XLen(ctx, requestStream).Val(); n != 0 {
+		t.Fatalf("%d entries left in the stream", n)
+	}
+}
+
+func TestRedisStreamsLeavesBusyEntries(t *testing.T) {
+	r, _ := newTestStreams(t, Options{ClaimIdle: time.Minute})
+
+	if err := r.Publish(Message{TaskID: "busy", Prompt: "hi"}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	_, err := r.client.XReadGroup(context.Background(), &redis.XReadGroupArgs{
+		Group: consumerGroup, Consumer: "slow", Streams: []string{requestStream, ">"}, Count: 1,
+	}).Result()
+	if err != nil {
+		t.Fatalf("XReadGroup: %v", err)
+	}
+
+	select {
+	case d := <-consume(t, r):
+		t.Fatalf("claimed %s before it went idle", d.Body())
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestRedisStreamsRetryAndDeadLetter(t *testing.T) {
+	r, _ := newTestStreams(t, Options{MaxDeliveries: 2})
+	deliveries := consume(t, r)
+
+	if err := r.Publish(Message{TaskID: "t1", Prompt: "hi"}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if err := next(t, deliveries).Release(); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if dead, err := next(t, deliveries).Retry("provider down"); dead || err != nil {
+		t.Fatalf("first Retry = %v, %v; want requeued", dead, err)
+	}
+	if dead, err := next(t, deliveries).Retry("provider down"); !dead || err != nil {
+		t.Fatalf("second Retry = %v, %v; want dead-lettered", dead, err)
+	}
+
+	letters, err := r.InspectDeadLetters(0)
+	if err != nil {
+		t.Fatalf("InspectDeadLetters: %v", err)
+	}
+	if len(letters) != 1 || letters[0].TaskID != "t1" || letters[0].Deliveries != 2 ||
+		letters[0].Reason != "provider down (after 2 deliveries)" || letters[0].FailedAt.IsZero() {
+		t.Fatalf("dead letters = %+v", letters)
+	}
+
+	if n, err := r.ReplayDeadLetters(0, "t1"); n != 1 || err != nil {
+		t.Fatalf("ReplayDeadLetters = %d, %v", n, err)
+	}
+	d := next(t, deliveries)
+	if taskIDOf(d.Body()) != "t1" {
+		t.Fatalf("replayed body = %s", d.Body())
+	}
+	if err := d.Ack(); err != nil {
+		t.Fatalf("Ack: %v", err)
+	}
+	if letters, _ := r.InspectDeadLetters(0); len(letters) != 0 {
+		t.Fatalf("dead letters after replay = %+v", letters)
+	}
+}
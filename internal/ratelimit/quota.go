@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/facade"
+	"github.com/redis/go-redis/v9"
+)
+
+// Quota periods reported by UseQuota
+const (
+	PeriodDay   = "daily"
+	PeriodMonth = "monthly"
+)
+
+// Quota counters live at quota:<tenant>:day:<date> and
+// quota:<tenant>:month:<month>, expiring a day after their period ends
+func quotaKeys(tenant string, now time.Time) []string {
+	return []string{
+		"quota:" + tenant + ":day:" + now.Format(time.DateOnly),
+		"quota:" + tenant + ":month:" + now.Format("2006-01"),
+	}
+}
+
+// quotaScript counts one submission against the day and month counters
+// unless either is already at its limit (0 for none). ARGV holds the daily
+// and monthly limits, then each counter's expiry in seconds. It returns 0
+// when counted, 1 when the daily limit was hit and 2 for the monthly one.
+var quotaScript = redis.NewScript(`
+local day = tonumber(redis.call('GET', KEYS[1]) or '0')
+local month = tonumber(redis.call('GET', KEYS[2]) or '0')
+local daily, monthly = tonumber(ARGV[1]), tonumber(ARGV[2])
+if monthly > 0 and month >= monthly then
+	return 2
+end
+if daily > 0 and day >= daily then
+	return 1
+end
+redis.call('INCR', KEYS[1])
+redis.call('EXPIRE', KEYS[1], ARGV[3])
+redis.call('INCR', KEYS[2])
+redis.call('EXPIRE', KEYS[2], ARGV[4])
+return 0
+`)
+
+// UseQuota counts one submission by tenant against q. When a limit is
+// already reached it counts nothing and returns the exhausted period and
+// how long until it resets.
+func (l *Limiter) UseQuota(tenant string, q facade.Quota) (period string, retryAfter time.Duration, err error) {
+	if q.Daily == 0 && q.Monthly == 0 {
+		return "", 0, nil
+	}
+	now := l.now().UTC()
+	nextDay := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	nextMonth := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	dayTTL := int64(nextDay.Add(24*time.Hour).Sub(now).Seconds()) + 1
+	monthTTL := int64(nextMonth.Add(24*time.Hour).Sub(now).Seconds()) + 1
+
+	hit, err := quotaScript.Run(l.ctx, l.client, quotaKeys(tenant, now), q.Daily, q.Monthly, dayTTL, monthTTL).Int()
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to check quota: %v", err)
+	}
+	switch hit {
+	case 1:
+		return PeriodDay, nextDay.Sub(now), nil
+	case 2:
+		return PeriodMonth, nextMonth.Sub(now), nil
+	}
+	return "", 0, nil
+}
+
+// refundScript undoes one counted submission on counters that still exist
+var refundScript = redis.NewScript(`
+for _, key in ipairs(KEYS) do
+	if redis.call('EXISTS', key) == 1 then
+		redis.call('DECR', key)
+	end
+end
+return 0
+`)
+
+// RefundQuota gives back a submission counted by UseQuota, e.g. when the
+// task could not be queued after all
+func (l *Limiter) RefundQuota(tenant string, q facade.Quota) error {
+	if q.Daily == 0 && q.Monthly == 0 {
+		return nil
+	}
+	if err := refundScript.Run(l.ctx, l.client, quotaKeys(tenant, l.now().UTC())).Err(); err != nil {
+		return fmt.Errorf("failed to refund quota: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/facade"
+)
+
+// useQuota calls UseQuota and fails the test unless it reports want
+// exhausted (empty when counted), resetting after retryAfter
+func useQuota(t *testing.T, l *Limiter, q facade.Quota, want string, retryAfter time.Duration) {
+	t.Helper()
+	period, wait, err := l.UseQuota("acme", q)
+	if err != nil {
+		t.Fatalf("UseQuota: %v", err)
+	}
+	if period != want || wait != retryAfter {
+		t.Fatalf("UseQuota = %q, %v; want %q, %v", period, wait, want, retryAfter)
+	}
+}
+
+func TestQuotaDayRollover(t *testing.T) {
+	l, mr, now := newTestLimiter(t, time.Date(2024, 1, 31, 23, 59, 0, 0, time.UTC))
+	q := facade.Quota{Daily: 2, Monthly: 10}
+
+	useQuota(t, l, q, "", 0)
+	useQuota(t, l, q, "", 0)
+	useQuota(t, l, q, PeriodDay, time.Minute)
+	if got, _ := mr.Get("quota:acme:day:2024-01-31"); got != "2" {
+		t.Errorf("day counter = %q, want 2: refused submissions are not counted", got)
+	}
+	// Counters outlive their period by a day
+	if ttl := mr.TTL("quota:acme:day:2024-01-31"); ttl != 24*time.Hour+time.Minute+time.Second {
+		t.Errorf("day counter TTL = %v", ttl)
+	}
+
+	// Midnight UTC starts a new day, and here a new month
+	*now = now.Add(time.Minute)
+	useQuota(t, l, q, "", 0)
+	if got, _ := mr.Get("quota:acme:month:2024-02"); got != "1" {
+		t.Errorf("February counter = %q, want 1", got)
+	}
+}
+
+func TestQuotaMonthRollover(t *testing.T) {
+	l, _, now := newTestLimiter(t, time.Date(2024, 3, 30, 12, 0, 0, 0, time.UTC))
+	q := facade.Quota{Daily: 2, Monthly: 3}
+
+	useQuota(t, l, q, "", 0)
+	useQuota(t, l, q, "", 0)
+	useQuota(t, l, q, PeriodDay, 12*time.Hour)
+
+	*now = time.Date(2024, 3, 31, 6, 0, 0, 0, time.UTC)
+	useQuota(t, l, q, "", 0)
+	// The month is used up although today's quota is not
+	useQuota(t, l, q, PeriodMonth, 18*time.Hour)
+
+	*now = time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	useQuota(t, l, q, "", 0)
+}
+
+func TestQuotaUsesUTC(t *testing.T) {
+	// 08:00 on May 2nd in UTC+10 is still May 1st in UTC
+	start := time.Date(2024, 5, 2, 8, 0, 0, 0, time.FixedZone("AEST", 10*60*60))
+	l, mr, _ := newTestLimiter(t, start)
+
+	useQuota(t, l, facade.Quota{Daily: 1}, "", 0)
+	if !mr.Exists("quota:acme:day:2024-05-01") {
+		t.Errorf("keys = %v, want the UTC day's counter", mr.Keys())
+	}
+	useQuota(t, l, facade.Quota{Daily: 1}, PeriodDay, 2*time.Hour)
+}
+
+func TestRefundQuota(t *testing.T) {
+	l, mr, _ := newTestLimiter(t, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	q := facade.Quota{Daily: 1, Monthly: 5}
+
+	useQuota(t, l, q, "", 0)
+	useQuota(t, l, q, PeriodDay, 12*time.Hour)
+	if err := l.RefundQuota("acme", q); err != nil {
+		t.Fatalf("RefundQuota: %v", err)
+	}
+	useQuota(t, l, q, "", 0)
+	if got, _ := mr.Get("quota:acme:month:2024-05"); got != "1" {
+		t.Errorf("month counter = %q, want 1", got)
+	}
+}
+
+func TestQuotaUnlimited(t *testing.T) {
+	l, mr, _ := newTestLimiter(t, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	useQuota(t, l, facade.Quota{}, "", 0)
+	if err := l.RefundQuota("acme", facade.Quota{}); err != nil {
+		t.Fatalf("RefundQuota: %v", err)
+	}
+	if keys := mr.Keys(); len(keys) != 0 {
+		t.Errorf("keys = %v, want no counters without a quota", keys)
+	}
+}
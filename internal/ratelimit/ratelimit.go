@@ -0,0 +1,142 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/facade"
+	"github.com/redis/go-redis/v9"
+)
+
+// Limiter enforces token buckets and quotas kept in Redis, so that every
+// api_server and worker replica draws from the same limits
+type Limiter struct {
+	client *redis.Client
+	ctx    context.Context
+	now    func() time.Time
+}
+
+// New connects to the Redis holding the limits
+func New(url string) (*Limiter, error) {
+	if url == "" {
+		return nil, fmt.Errorf("missing Redis URL")
+	}
+	opt, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Redis URL: %v", err)
+	}
+	client := redis.NewClient(opt)
+	ctx := context.Background()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to Redis: %v", err)
+	}
+	return &Limiter{client: client, ctx: ctx, now: time.Now}, nil
+}
+
+// Close closes the Redis connection
+func (l *Limiter) Close() error {
+	return l.client.Close()
+}
+
+// Bucket is one token bucket, holding up to Burst tokens and refilled at
+// Rate tokens per second. Cost is what the current request takes from it.
+type Bucket struct {
+	Key   string
+	Rate  float64
+	Burst float64
+	Cost  float64
+}
+
+// takeScript takes Cost tokens from every bucket, or from none of them.
+// KEYS are the buckets; ARGV[1] is the time in ms, followed by rate (per
+// ms), burst and cost for each bucket. It returns 0 when the tokens were
+// taken, otherwise the ms until they would all be available.
+var takeScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local wait = 0
+local levels = {}
+for i, key in ipairs(KEYS) do
+	local rate = tonumber(ARGV[3*i-1])
+	local burst = tonumber(ARGV[3*i])
+	local cost = math.min(tonumber(ARGV[3*i+1]), burst)
+	local state = redis.call('HMGET', key, 'tokens', 'ts')
+	local tokens = tonumber(state[1]) or burst
+	local ts = tonumber(state[2]) or now
+	tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+	if tokens < cost then
+		wait = math.max(wait, (cost - tokens) / rate)
+	end
+	levels[i] = tokens - cost
+end
+if wait > 0 then
+	return math.ceil(wait)
+end
+for i, key in ipairs(KEYS) do
+	redis.call('HSET', key, 'tokens', tostring(levels[i]), 'ts', now)
+	redis.call('PEXPIRE', key, math.ceil(tonumber(ARGV[3*i]) / tonumber(ARGV[3*i-1])) + 1000)
+end
+return 0
+`)
+
+// Take takes each bucket's cost if all of them have enough tokens. It
+// returns 0 on success, or how long to wait before trying again.
+func (l *Limiter) Take(buckets ...Bucket) (time.Duration, error) {
+	if len(buckets) == 0 {
+		return 0, nil
+	}
+	keys := make([]string, len(buckets))
+	args := []interface{}{l.now().UnixMilli()}
+	for i, b := range buckets {
+		keys[i] = b.Key
+		args = append(args, b.Rate/1000, b.Burst, b.Cost)
+	}
+	ms, err := takeScript.Run(l.ctx, l.client, keys, args...).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to take rate limit tokens: %v", err)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// Wait takes each bucket's cost, blocking until the buckets allow it or
+// ctx is done
+func (l *Limiter) Wait(ctx context.Context, buckets ...Bucket) error {
+	for {
+		wait, err := l.Take(buckets...)
+		if err != nil || wait == 0 {
+			return err
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// Providers returns a facade.Limiter enforcing limits, keyed by provider
+// name. Providers without a limit are not held back.
+func (l *Limiter) Providers(limits map[string]facade.ProviderLimit) facade.Limiter {
+	return providerLimiter{l: l, limits: limits}
+}
+
+// providerLimiter applies per-minute request and token buckets per provider
+type providerLimiter struct {
+	l      *Limiter
+	limits map[string]facade.ProviderLimit
+}
+
+func (p providerLimiter) Wait(ctx context.Context, provider string, tokens int) error {
+	limit := p.limits[provider]
+	var buckets []Bucket
+	if limit.RPM > 0 {
+		buckets = append(buckets, Bucket{Key: "ratelimit:provider:" + provider + ":rpm", Rate: float64(limit.RPM) / 60, Burst: float64(limit.RPM), Cost: 1})
+	}
+	if limit.TPM > 0 {
+		buckets = append(buckets, Bucket{Key: "ratelimit:provider:" + provider + ":tpm", Rate: float64(limit.TPM) / 60, Burst: float64(limit.TPM), Cost: float64(tokens)})
+	}
+	return p.l.Wait(ctx, buckets...)
+}
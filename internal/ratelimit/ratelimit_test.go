@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/facade"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestLimiter returns a Limiter on a fresh miniredis whose clock is
+// the returned time, which tests move forward by hand
+func newTestLimiter(t *testing.T, start time.Time) (*Limiter, *miniredis.Miniredis, *time.Time) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	now := start
+	return &Limiter{client: client, ctx: context.Background(), now: func() time.Time { return now }}, mr, &now
+}
+
+// take calls Take and fails the test unless it waits about want
+func take(t *testing.T, l *Limiter, want time.Duration, buckets ...Bucket) {
+	t.Helper()
+	wait, err := l.Take(buckets...)
+	if err != nil {
+		t.Fatalf("Take: %v", err)
+	}
+	// The script rounds the wait up to whole ms
+	if wait < want || wait > want+2*time.Millisecond {
+		t.Fatalf("Take waits %v, want %v", wait, want)
+	}
+}
+
+func TestTakeBurstAndRefill(t *testing.T) {
+	l, _, now := newTestLimiter(t, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	b := Bucket{Key: "ratelimit:key:k1", Rate: 2, Burst: 3, Cost: 1}
+
+	// A new bucket is full, so a burst of 3 passes at once
+	for i := 0; i < 3; i++ {
+		take(t, l, 0, b)
+	}
+	take(t, l, 500*time.Millisecond, b)
+
+	// Half a token refills in 250ms, and the refused take used none
+	*now = now.Add(250 * time.Millisecond)
+	take(t, l, 250*time.Millisecond, b)
+	*now = now.Add(250 * time.Millisecond)
+	take(t, l, 0, b)
+	take(t, l, 500*time.Millisecond, b)
+
+	// An idle bucket refills to its burst and no further
+	*now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		take(t, l, 0, b)
+	}
+	take(t, l, 500*time.Millisecond, b)
+}
+
+func TestTakeCostAboveBurst(t *testing.T) {
+	l, _, _ := newTestLimiter(t, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	b := Bucket{Key: "ratelimit:provider:openai:tpm", Rate: 10, Burst: 100, Cost: 500}
+
+	// A cost no bucket could ever hold takes the whole burst instead of
+	// waiting forever
+	take(t, l, 0, b)
+	take(t, l, 10*time.Second, b)
+}
+
+func TestTakeAllOrNothing(t *testing.T) {
+	l, _, _ := newTestLimiter(t, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	tight := Bucket{Key: "ratelimit:tight", Rate: 1, Burst: 1, Cost: 1}
+	loose := Bucket{Key: "ratelimit:loose", Rate: 1, Burst: 3, Cost: 1}
+
+	take(t, l, 0, tight, loose)
+	take(t, l, time.Second, tight, loose)
+	// The refused take left loose with its 2 remaining tokens
+	take(t, l, 0, loose)
+	take(t, l, 0, loose)
+	take(t, l, time.Second, loose)
+}
+
+func TestProviderLimiter(t *testing.T) {
+	l, mr, _ := newTestLimiter(t, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	p := l.Providers(map[string]facade.ProviderLimit{"openai": {RPM: 60, TPM: 1000}})
+	ctx := context.Background()
+
+	if err := p.Wait(ctx, "openai", 800); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if !mr.Exists("ratelimit:provider:openai:rpm") || !mr.Exists("ratelimit:provider:openai:tpm") {
+		t.Errorf("keys = %v, want the openai rpm and tpm buckets", mr.Keys())
+	}
+
+	// 200 tokens remain, so another 800-token request must wait
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := p.Wait(cancelled, "openai", 800); err != context.Canceled {
+		t.Errorf("over TPM: Wait = %v, want context.Canceled", err)
+	}
+	if err := p.Wait(cancelled, "anthropic", 800); err != nil {
+		t.Errorf("unlimited provider: Wait = %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Spend is what has been spent in USD in the current UTC day and month, by
+// one tenant and by all tenants together
+type Spend struct {
+	TenantDay   float64
+	TenantMonth float64
+	GlobalDay   float64
+	GlobalMonth float64
+}
+
+// Spend counters live at spend:tenant:<tenant>:day:<date>,
+// spend:tenant:<tenant>:month:<month> and the same under spend:global,
+// expiring a day after their period ends
+func spendKeys(tenant string, now time.Time) []string {
+	day, month := now.Format(time.DateOnly), now.Format("2006-01")
+	return []string{
+		"spend:tenant:" + tenant + ":day:" + day,
+		"spend:tenant:" + tenant + ":month:" + month,
+		"spend:global:day:" + day,
+		"spend:global:month:" + month,
+	}
+}
+
+// Spend returns what tenant, and everyone, has spent so far
+func (l *Limiter) Spend(tenant string) (Spend, error) {
+	values, err := l.client.MGet(l.ctx, spendKeys(tenant, l.now().UTC())...).Result()
+	if err != nil {
+		return Spend{}, fmt.Errorf("failed to get spend: %v", err)
+	}
+	var totals [4]float64
+	for i, v := range values {
+		if s, ok := v.(string); ok {
+			totals[i], _ = strconv.ParseFloat(s, 64)
+		}
+	}
+	return Spend{TenantDay: totals[0], TenantMonth: totals[1], GlobalDay: totals[2], GlobalMonth: totals[3]}, nil
+}
+
+// AddSpend adds cost to tenant's and the global spend and returns the new
+// totals. Each increment is atomic, so exactly one caller sees a total
+// cross any given amount.
+func (l *Limiter) AddSpend(tenant string, cost float64) (Spend, error) {
+	now := l.now().UTC()
+	nextDay := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	nextMonth := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	ttls := []time.Duration{nextDay.Sub(now), nextMonth.Sub(now), nextDay.Sub(now), nextMonth.Sub(now)}
+
+	keys := spendKeys(tenant, now)
+	totals := make([]*redis.FloatCmd, len(keys))
+	_, err := l.client.TxPipelined(l.ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			totals[i] = pipe.IncrByFloat(l.ctx, key, cost)
+			pipe.Expire(l.ctx, key, ttls[i]+24*time.Hour)
+		}
+		return nil
+	})
+	if err != nil {
+		return Spend{}, fmt.Errorf("failed to add spend: %v", err)
+	}
+	return Spend{TenantDay: totals[0].Val(), TenantMonth: totals[1].Val(), GlobalDay: totals[2].Val(), GlobalMonth: totals[3].Val()}, nil
+}
@@ -0,0 +1,231 @@
+package storage
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// apiKeyPrefix starts every API key, so leaked keys are easy to recognise
+const apiKeyPrefix = "aiw_"
+
+// AnonymousTenant owns everything api_server does with AUTH_REQUIRED=false.
+// API keys cannot be issued for it.
+const AnonymousTenant = "anonymous"
+
+// ErrKeyNotFound is returned when revoking an API key that does not exist
+var ErrKeyNotFound = errors.New("API key not found")
+
+// APIKey is the stored record of an API key. Only a hash of the key is
+// kept; the key itself is shown once, when it is created.
+type APIKey struct {
+	ID        string     `json:"id"`
+	Tenant    string     `json:"tenant"`
+	Name      string     `json:"name,omitempty"`
+	Hash      string     `json:"-"`
+	Prefix    string     `json:"prefix"` // First characters of the key, to tell keys apart
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Revoked reports whether the key may no longer be used
+func (k *APIKey) Revoked() bool {
+	return k.RevokedAt != nil
+}
+
+// KeyStore keeps API keys and the tenants they belong to
+type KeyStore interface {
+	// CreateAPIKey stores a new key record
+	CreateAPIKey(key APIKey) error
+	// LookupAPIKey returns the key with the given hash, or nil if there is none
+	LookupAPIKey(hash string) (*APIKey, error)
+	// ListAPIKeys returns the keys of tenant, or of every tenant when it is empty
+	ListAPIKeys(tenant string) ([]APIKey, error)
+	// RevokeAPIKey marks the key with the given ID revoked
+	RevokeAPIKey(id string) error
+}
+
+// NewAPIKey generates a key for tenant, returning the key to hand out and
+// the record to store
+func NewAPIKey(tenant, name string) (string, APIKey, error) {
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", APIKey{}, fmt.Errorf("failed to generate API key: %v", err)
+	}
+	key := apiKeyPrefix + hex.EncodeToString(secret)
+	return key, APIKey{
+		ID:        uuid.New().String(),
+		Tenant:    tenant,
+		Name:      name,
+		Hash:      HashAPIKey(key),
+		Prefix:    key[:len(apiKeyPrefix)+8],
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
+
+// HashAPIKey returns the hash under which key is stored. Keys are long
+// and random, so an unsalted SHA-256 is enough.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// API keys live in a hash at apikey:<id>, found by hash through
+// apikey:hash:<hash>; the set apikeys lists every ID. None expire.
+func apiKeyKey(id string) string {
+	return "apikey:" + id
+}
+
+func apiKeyHashKey(hash string) string {
+	return "apikey:hash:" + hash
+}
+
+const apiKeysSet = "apikeys"
+
+// CreateAPIKey stores a new key record
+func (r *RedisClient) CreateAPIKey(key APIKey) error {
+	_, err := r.client.TxPipelined(r.ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(r.ctx, apiKeyKey(key.ID), "tenant", key.Tenant, "name", key.Name, "hash", key.Hash,
+			"prefix", key.Prefix, "created_at", formatTime(key.CreatedAt))
+		pipe.Set(r.ctx, apiKeyHashKey(key.Hash), key.ID, 0)
+		pipe.SAdd(r.ctx, apiKeysSet, key.ID)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create API key in Redis: %v", err)
+	}
+	return nil
+}
+
+// LookupAPIKey returns the key with the given hash, or nil if there is none
+func (r *RedisClient) LookupAPIKey(hash string) (*APIKey, error) {
+	id, err := r.client.Get(r.ctx, apiKeyHashKey(hash)).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up API key in Redis: %v", err)
+	}
+	return r.getAPIKey(id)
+}
+
+// getAPIKey returns the key record with the given ID, or nil if there is none
+func (r *RedisClient) getAPIKey(id string) (*APIKey, error) {
+	h, err := r.client.HGetAll(r.ctx, apiKeyKey(id)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API key from Redis: %v", err)
+	}
+	if len(h) == 0 {
+		return nil, nil
+	}
+	key := &APIKey{ID: id, Tenant: h["tenant"], Name: h["name"], Hash: h["hash"], Prefix: h["prefix"]}
+	key.CreatedAt, _ = time.Parse(time.RFC3339Nano, h["created_at"])
+	key.RevokedAt = parseOptionalTime(h["revoked_at"])
+	return key, nil
+}
+
+// ListAPIKeys returns the keys of tenant, or of every tenant when it is empty
+func (r *RedisClient) ListAPIKeys(tenant string) ([]APIKey, error) {
+	ids, err := r.client.SMembers(r.ctx, apiKeysSet).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys in Redis: %v", err)
+	}
+	var keys []APIKey
+	for _, id := range ids {
+		key, err := r.getAPIKey(id)
+		if err != nil {
+			return nil, err
+		}
+		if key != nil && (tenant == "" || key.Tenant == tenant) {
+			keys = append(keys, *key)
+		}
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey marks the key with the given ID revoked
+func (r *RedisClient) RevokeAPIKey(id string) error {
+	n, err := r.client.Exists(r.ctx, apiKeyKey(id)).Result()
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key in Redis: %v", err)
+	}
+	if n == 0 {
+		return ErrKeyNotFound
+	}
+	if err := r.client.HSetNX(r.ctx, apiKeyKey(id), "revoked_at", formatTime(time.Now())).Err(); err != nil {
+		return fmt.Errorf("failed to revoke API key in Redis: %v", err)
+	}
+	return nil
+}
+
+// CreateAPIKey stores a new key record
+func (s *SQLStore) CreateAPIKey(key APIKey) error {
+	_, err := s.db.Exec(`INSERT INTO api_keys (id, tenant, name, key_hash, prefix, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		key.ID, key.Tenant, key.Name, key.Hash, key.Prefix, key.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create API key in database: %v", err)
+	}
+	return nil
+}
+
+// LookupAPIKey returns the key with the given hash, or nil if there is none
+func (s *SQLStore) LookupAPIKey(hash string) (*APIKey, error) {
+	keys, err := s.queryAPIKeys(`WHERE key_hash = $1`, hash)
+	if err != nil || len(keys) == 0 {
+		return nil, err
+	}
+	return &keys[0], nil
+}
+
+// ListAPIKeys returns the keys of tenant, or of every tenant when it is empty
+func (s *SQLStore) ListAPIKeys(tenant string) ([]APIKey, error) {
+	if tenant == "" {
+		return s.queryAPIKeys(`ORDER BY created_at`)
+	}
+	return s.queryAPIKeys(`WHERE tenant = $1 ORDER BY created_at`, tenant)
+}
+
+// RevokeAPIKey marks the key with the given ID revoked
+func (s *SQLStore) RevokeAPIKey(id string) error {
+	res, err := s.db.Exec(`UPDATE api_keys SET revoked_at = COALESCE(revoked_at, $1) WHERE id = $2`, time.Now().UTC(), id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key in database: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
+// queryAPIKeys returns the api_keys rows selected by the given clause
+func (s *SQLStore) queryAPIKeys(clause string, args ...interface{}) ([]APIKey, error) {
+	rows, err := s.db.Query(`SELECT id, tenant, name, key_hash, prefix, created_at, revoked_at FROM api_keys `+clause, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API keys from database: %v", err)
+	}
+	defer rows.Close()
+	var keys []APIKey
+	for rows.Next() {
+		var key APIKey
+		var revoked sql.NullTime
+		if err := rows.Scan(&key.ID, &key.Tenant, &key.Name, &key.Hash, &key.Prefix, &key.CreatedAt, &revoked); err != nil {
+			return nil, fmt.Errorf("failed to read API key: %v", err)
+		}
+		if revoked.Valid {
+			key.RevokedAt = &revoked.Time
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read API keys: %v", err)
+	}
+	return keys, nil
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// keyStores returns an empty SQLite store and an empty Redis store
+func keyStores(t *testing.T) map[string]KeyStore {
+	t.Helper()
+	sqlStore, err := NewSQLStore(DriverSQLite, "file:"+t.TempDir()+"/keys.db")
+	if err != nil {
+		t.Fatalf("NewSQLStore: %v", err)
+	}
+	t.Cleanup(func() { sqlStore.Close() })
+	redisStore, err := NewRedisClient("redis://"+miniredis.RunT(t).Addr(), time.Hour)
+	if err != nil {
+		t.Fatalf("NewRedisClient: %v", err)
+	}
+	t.Cleanup(func() { redisStore.Close() })
+	return map[string]KeyStore{"sql": sqlStore, "redis": redisStore}
+}
+
+func TestNewAPIKey(t *testing.T) {
+	key, record, err := NewAPIKey("acme", "ci")
+	if err != nil {
+		t.Fatalf("NewAPIKey: %v", err)
+	}
+	if !strings.HasPrefix(key, apiKeyPrefix) || !strings.HasPrefix(key, record.Prefix) || record.Hash != HashAPIKey(key) {
+		t.Errorf("key %q, record %+v", key, record)
+	}
+	if strings.Contains(record.Hash, key) || record.Revoked() {
+		t.Errorf("record = %+v", record)
+	}
+}
+
+func TestKeyStore(t *testing.T) {
+	for name, store := range keyStores(t) {
+		t.Run(name, func(t *testing.T) {
+			key, acme, _ := NewAPIKey("acme", "ci")
+			_, globex, _ := NewAPIKey("globex", "")
+			for _, k := range []APIKey{acme, globex} {
+				if err := store.CreateAPIKey(k); err != nil {
+					t.Fatalf("CreateAPIKey: %v", err)
+				}
+			}
+
+			got, err := store.LookupAPIKey(HashAPIKey(key))
+			if err != nil || got == nil || got.ID != acme.ID || got.Tenant != "acme" || got.Name != "ci" || got.Revoked() {
+				t.Fatalf("LookupAPIKey = %+v, %v", got, err)
+			}
+			if got, err := store.LookupAPIKey(HashAPIKey(key + "x")); got != nil || err != nil {
+				t.Errorf("unknown key: LookupAPIKey = %+v, %v", got, err)
+			}
+
+			if keys, err := store.ListAPIKeys("acme"); err != nil || len(keys) != 1 || keys[0].ID != acme.ID {
+				t.Errorf("ListAPIKeys(acme) = %+v, %v", keys, err)
+			}
+			if keys, err := store.ListAPIKeys(""); err != nil || len(keys) != 2 {
+				t.Errorf("ListAPIKeys() = %+v, %v", keys, err)
+			}
+
+			if err := store.RevokeAPIKey(acme.ID); err != nil {
+				t.Fatalf("RevokeAPIKey: %v", err)
+			}
+			if got, err := store.LookupAPIKey(HashAPIKey(key)); err != nil || got == nil || !got.Revoked() {
+				t.Errorf("after revoking: LookupAPIKey = %+v, %v", got, err)
+			}
+			if err := store.RevokeAPIKey("no-such-key"); !errors.Is(err, ErrKeyNotFound) {
+				t.Errorf("RevokeAPIKey(unknown) = %v, want ErrKeyNotFound", err)
+			}
+		})
+	}
+}
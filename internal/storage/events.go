@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/facade"
+)
+
+// Task event types, in the order a subscriber sees them
+const (
+	EventDelta  = "delta"  // Token delta from one provider (streaming tasks only)
+	EventResult = "result" // One provider finished
+	EventDone   = "done"   // Merged result stored; no more events follow
+	EventFailed = "failed" // Task failed; no more events follow
+)
+
+// TaskEvent is a progress update published while a worker processes a task
+type TaskEvent struct {
+	Type   string                    `json:"type"`
+	TaskID string                    `json:"task_id"`
+	Source string                    `json:"source,omitempty"`
+	Delta  string                    `json:"delta,omitempty"`
+	Result *facade.ApiResponse       `json:"result,omitempty"`
+	Merged *facade.MergedApiResponse `json:"merged,omitempty"`
+	Error  string                    `json:"error,omitempty"`
+}
+
+// Final reports whether no more events follow this one
+func (ev TaskEvent) Final() bool {
+	return ev.Type == EventDone || ev.Type == EventFailed
+}
+
+func eventsChannel(taskID string) string {
+	return "task_events:" + taskID
+}
+
+// PublishEvent broadcasts a task event to subscribers via Redis pub/sub.
+// Events are not persisted; subscribers that join late should read the
+// stored result first.
+func (r *RedisClient) PublishEvent(ev TaskEvent) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("marshal error: %v", err)
+	}
+	if err := r.client.Publish(r.ctx, eventsChannel(ev.TaskID), data).Err(); err != nil {
+		return fmt.Errorf("failed to publish event: %v", err)
+	}
+	return nil
+}
+
+// SubscribeEvents returns the events published for a task until ctx is
+// cancelled. The subscription is active when SubscribeEvents returns, so
+// a result checked afterwards cannot be missed.
+func (r *RedisClient) SubscribeEvents(ctx context.Context, taskID string) (<-chan TaskEvent, error) {
+	pubsub := r.client.Subscribe(ctx, eventsChannel(taskID))
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, fmt.Errorf("failed to subscribe: %v", err)
+	}
+
+	out := make(chan TaskEvent)
+	go func() {
+		defer close(out)
+		defer pubsub.Close()
+		msgs := pubsub.Channel()
+		for {
+			select {
+			case msg, ok := <-msgs:
+				if !ok {
+					return
+				}
+				var ev TaskEvent
+				if err := json.Unmarshal([]byte(msg.Payload), &ev); err != nil {
+					log.Printf("Dropping malformed event for task %s: %v", taskID, err)
+					continue
+				}
+				select {
+				case out <- ev:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/Rammurthy5/ai_agents_wrapper/internal/facade"
@@ -13,9 +14,12 @@ import (
 type RedisClient struct {
 	client *redis.Client
 	ctx    context.Context
+	ttl    time.Duration // Expiry of task records after their last update
 }
 
-func NewRedisClient(url string) (*RedisClient, error) {
+// NewRedisClient connects to Redis. Task records expire ttl after their
+// last update; ttl <= 0 selects defaultTaskTTL.
+func NewRedisClient(url string, ttl time.Duration) (*RedisClient, error) {
 	opt, err := redis.ParseURL(url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse Redis URL: %v", err)
@@ -29,36 +33,225 @@ func NewRedisClient(url string) (*RedisClient, error) {
 		return nil, fmt.Errorf("failed to connect to Redis: %v", err)
 	}
 
-	return &RedisClient{client: client, ctx: ctx}, nil
+	if ttl <= 0 {
+		ttl = defaultTaskTTL
+	}
+	return &RedisClient{client: client, ctx: ctx, ttl: ttl}, nil
+}
+
+// Task records live in a hash at task:<id>, with partial provider results
+// in a list at task:<id>:partial. Both expire the client's TTL after the
+// last update.
+const defaultTaskTTL = 1 * time.Hour
+
+func taskKey(taskID string) string {
+	return "task:" + taskID
+}
+
+func partialKey(taskID string) string {
+	return "task:" + taskID + ":partial"
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// CreateTask records a newly queued task and its tenant. The request
+// itself is not kept.
+func (r *RedisClient) CreateTask(taskID, tenant string, req facade.Request) error {
+	now := formatTime(time.Now())
+	_, err := r.client.TxPipelined(r.ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(r.ctx, taskKey(taskID), "status", StatusQueued, "tenant", tenant, "created_at", now, "updated_at", now)
+		pipe.Expire(r.ctx, taskKey(taskID), r.ttl)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create task in Redis: %v", err)
+	}
+	return nil
+}
+
+// StartTask marks a task as running on the given worker. Tasks queued
+// without a record (e.g. by the CLI) get one here.
+func (r *RedisClient) StartTask(taskID, workerID, tenant string, req facade.Request) error {
+	now := formatTime(time.Now())
+	_, err := r.client.TxPipelined(r.ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSetNX(r.ctx, taskKey(taskID), "created_at", now)
+		pipe.HSet(r.ctx, taskKey(taskID), "status", StatusRunning, "tenant", tenant, "worker_id", workerID, "started_at", now, "updated_at", now)
+		pipe.Del(r.ctx, partialKey(taskID)) // A redelivered task starts over
+		pipe.Expire(r.ctx, taskKey(taskID), r.ttl)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start task in Redis: %v", err)
+	}
+	return nil
+}
+
+// AddPartialResult appends one provider's result and marks the task partial
+func (r *RedisClient) AddPartialResult(taskID string, resp facade.ApiResponse) error {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("marshal error: %v", err)
+	}
+	_, err = r.client.TxPipelined(r.ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(r.ctx, partialKey(taskID), data)
+		pipe.HSet(r.ctx, taskKey(taskID), "status", StatusPartial, "updated_at", formatTime(time.Now()))
+		pipe.Expire(r.ctx, partialKey(taskID), r.ttl)
+		pipe.Expire(r.ctx, taskKey(taskID), r.ttl)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store partial result in Redis: %v", err)
+	}
+	return nil
 }
 
+// StoreResult stores the merged result and marks the task done, or failed
+// when no provider succeeded
 func (r *RedisClient) StoreResult(taskID string, result facade.MergedApiResponse) error {
 	data, err := json.Marshal(result)
 	if err != nil {
 		return fmt.Errorf("marshal error: %v", err)
 	}
 
-	// Store with a TTL of 1 hour (adjust as needed)
-	err = r.client.Set(r.ctx, taskID, data, 1*time.Hour).Err()
+	status, errMsg := StatusDone, ""
+	if !result.AnySucceeded() {
+		status, errMsg = StatusFailed, "all providers failed"
+	}
+	now := formatTime(time.Now())
+	_, err = r.client.TxPipelined(r.ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSetNX(r.ctx, taskKey(taskID), "created_at", now)
+		pipe.HSet(r.ctx, taskKey(taskID), "status", status, "result", data, "error", errMsg, "updated_at", now, "completed_at", now)
+		pipe.Del(r.ctx, partialKey(taskID))
+		pipe.Expire(r.ctx, taskKey(taskID), r.ttl)
+		return nil
+	})
 	if err != nil {
 		return fmt.Errorf("failed to store result in Redis: %v", err)
 	}
 	return nil
 }
 
-func (r *RedisClient) GetResult(taskID string) (*facade.MergedApiResponse, error) {
-	data, err := r.client.Get(r.ctx, taskID).Bytes()
-	if err == redis.Nil {
+// FailTask marks a task failed with the given reason
+func (r *RedisClient) FailTask(taskID, reason string) error {
+	now := formatTime(time.Now())
+	_, err := r.client.TxPipelined(r.ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSetNX(r.ctx, taskKey(taskID), "created_at", now)
+		pipe.HSet(r.ctx, taskKey(taskID), "status", StatusFailed, "error", reason, "updated_at", now, "completed_at", now)
+		pipe.Expire(r.ctx, taskKey(taskID), r.ttl)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mark task failed in Redis: %v", err)
+	}
+	return nil
+}
+
+// GetTask returns the task record, or nil if the task is unknown or expired
+func (r *RedisClient) GetTask(taskID string) (*Task, error) {
+	var fields *redis.MapStringStringCmd
+	var partial *redis.StringSliceCmd
+	_, err := r.client.Pipelined(r.ctx, func(pipe redis.Pipeliner) error {
+		fields = pipe.HGetAll(r.ctx, taskKey(taskID))
+		partial = pipe.LRange(r.ctx, partialKey(taskID), 0, -1)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get task from Redis: %v", err)
+	}
+	h := fields.Val()
+	if len(h) == 0 {
 		return nil, nil // Not found
-	} else if err != nil {
-		return nil, fmt.Errorf("failed to get result from Redis: %v", err)
 	}
 
-	var result facade.MergedApiResponse
-	if err := json.Unmarshal(data, &result); err != nil {
-		return nil, fmt.Errorf("unmarshal error: %v", err)
+	task := &Task{
+		ID:       taskID,
+		Status:   h["status"],
+		Tenant:   h["tenant"],
+		WorkerID: h["worker_id"],
+		Error:    h["error"],
+	}
+	task.CreatedAt, _ = time.Parse(time.RFC3339Nano, h["created_at"])
+	task.UpdatedAt, _ = time.Parse(time.RFC3339Nano, h["updated_at"])
+	task.StartedAt = parseOptionalTime(h["started_at"])
+	task.CompletedAt = parseOptionalTime(h["completed_at"])
+	if data := h["result"]; data != "" {
+		var result facade.MergedApiResponse
+		if err := json.Unmarshal([]byte(data), &result); err != nil {
+			return nil, fmt.Errorf("unmarshal error: %v", err)
+		}
+		task.Result = &result
+	}
+	for _, data := range partial.Val() {
+		var resp facade.ApiResponse
+		if err := json.Unmarshal([]byte(data), &resp); err != nil {
+			return nil, fmt.Errorf("unmarshal error: %v", err)
+		}
+		task.Partial = append(task.Partial, resp)
+	}
+	return task, nil
+}
+
+// GetResult returns the merged result of a finished task, or nil if the
+// task is unknown or still processing
+func (r *RedisClient) GetResult(taskID string) (*facade.MergedApiResponse, error) {
+	task, err := r.GetTask(taskID)
+	if err != nil || task == nil {
+		return nil, err
+	}
+	return task.Result, nil
+}
+
+// idempotencyKey is where an idempotency key's fingerprint and task ID live
+func idempotencyKey(key string) string {
+	return "idempotency:" + key
+}
+
+// ReserveIdempotencyKey maps key to taskID for window, or returns the
+// task ID it already maps to
+func (r *RedisClient) ReserveIdempotencyKey(key, fingerprint, taskID string, window time.Duration) (string, error) {
+	value := fingerprint + " " + taskID
+	for {
+		ok, err := r.client.SetNX(r.ctx, idempotencyKey(key), value, window).Result()
+		if err != nil {
+			return "", fmt.Errorf("failed to reserve idempotency key in Redis: %v", err)
+		}
+		if ok {
+			return "", nil
+		}
+		stored, err := r.client.Get(r.ctx, idempotencyKey(key)).Result()
+		if err == redis.Nil {
+			continue // Expired in between; try again
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read idempotency key from Redis: %v", err)
+		}
+		storedFingerprint, existing, _ := strings.Cut(stored, " ")
+		if storedFingerprint != fingerprint {
+			return "", ErrIdempotencyConflict
+		}
+		return existing, nil
+	}
+}
+
+// ReleaseIdempotencyKey forgets key
+func (r *RedisClient) ReleaseIdempotencyKey(key string) error {
+	if err := r.client.Del(r.ctx, idempotencyKey(key)).Err(); err != nil {
+		return fmt.Errorf("failed to release idempotency key in Redis: %v", err)
+	}
+	return nil
+}
+
+func parseOptionalTime(value string) *time.Time {
+	if value == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return nil
 	}
-	return &result, nil
+	return &t
 }
 
 func (r *RedisClient) Close() error {
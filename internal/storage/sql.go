@@ -0,0 +1,428 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/facade"
+
+	_ "github.com/jackc/pgx/v5/stdlib" // Registers the "pgx" driver
+	_ "modernc.org/sqlite"             // Registers the "sqlite" driver
+)
+
+// SQL drivers selectable with SQL_DRIVER
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+// sqlSchema is valid for both SQLite and Postgres. tasks holds one row
+// per task with its request as JSON; task_responses holds one row per
+// provider answer, kept for auditing after the task finishes. api_keys
+// holds hashed API keys and their tenants; usage_daily holds token and cost
+// totals per tenant, day, provider and model.
+var sqlSchema = []string{
+	`CREATE TABLE IF NOT EXISTS tasks (
+		id           TEXT PRIMARY KEY,
+		status       TEXT NOT NULL,
+		tenant       TEXT NOT NULL DEFAULT '',
+		worker_id    TEXT NOT NULL DEFAULT '',
+		messages     TEXT,
+		options      TEXT,
+		merge        TEXT,
+		result       TEXT,
+		error        TEXT NOT NULL DEFAULT '',
+		created_at   TIMESTAMP NOT NULL,
+		started_at   TIMESTAMP,
+		updated_at   TIMESTAMP NOT NULL,
+		completed_at TIMESTAMP
+	)`,
+	`CREATE INDEX IF NOT EXISTS tasks_created_at ON tasks (created_at)`,
+	`CREATE TABLE IF NOT EXISTS task_responses (
+		task_id       TEXT NOT NULL REFERENCES tasks (id) ON DELETE CASCADE,
+		source        TEXT NOT NULL,
+		message       TEXT NOT NULL DEFAULT '',
+		finish_reason TEXT NOT NULL DEFAULT '',
+		safety        TEXT,
+		error         TEXT NOT NULL DEFAULT '',
+		latency_ms    BIGINT,
+		model         TEXT NOT NULL DEFAULT '',
+		input_tokens  BIGINT,
+		output_tokens BIGINT,
+		cost          DOUBLE PRECISION,
+		created_at    TIMESTAMP NOT NULL,
+		PRIMARY KEY (task_id, source)
+	)`,
+	`CREATE TABLE IF NOT EXISTS idempotency_keys (
+		idempotency_key TEXT PRIMARY KEY,
+		fingerprint     TEXT NOT NULL,
+		task_id         TEXT NOT NULL,
+		expires_at      TIMESTAMP NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS api_keys (
+		id         TEXT PRIMARY KEY,
+		tenant     TEXT NOT NULL,
+		name       TEXT NOT NULL DEFAULT '',
+		key_hash   TEXT NOT NULL UNIQUE,
+		prefix     TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		revoked_at TIMESTAMP
+	)`,
+	`CREATE TABLE IF NOT EXISTS usage_daily (
+		tenant        TEXT NOT NULL,
+		day           TEXT NOT NULL,
+		source        TEXT NOT NULL,
+		model         TEXT NOT NULL DEFAULT '',
+		requests      BIGINT NOT NULL DEFAULT 0,
+		input_tokens  BIGINT NOT NULL DEFAULT 0,
+		output_tokens BIGINT NOT NULL DEFAULT 0,
+		cost          DOUBLE PRECISION NOT NULL DEFAULT 0,
+		PRIMARY KEY (tenant, day, source, model)
+	)`,
+}
+
+// SQLStore is a ResultStore that keeps every task, its request and each
+// provider's response indefinitely
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore opens the database at dsn with the given driver and
+// creates the schema if needed
+func NewSQLStore(driver, dsn string) (*SQLStore, error) {
+	if dsn == "" {
+		return nil, fmt.Errorf("missing SQL DSN")
+	}
+	driverName := driver
+	switch driver {
+	case DriverSQLite:
+	case DriverPostgres:
+		driverName = "pgx"
+	default:
+		return nil, fmt.Errorf("unknown SQL driver %q", driver)
+	}
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	if driver == DriverSQLite {
+		// SQLite allows one writer; serialising avoids SQLITE_BUSY
+		db.SetMaxOpenConns(1)
+		if _, err := db.Exec(`PRAGMA foreign_keys = ON`); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to enable foreign keys: %v", err)
+		}
+	}
+	for _, stmt := range sqlSchema {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to create schema: %v", err)
+		}
+	}
+	return &SQLStore{db: db}, nil
+}
+
+// CreateTask records a newly queued task, its tenant and its request
+func (s *SQLStore) CreateTask(taskID, tenant string, req facade.Request) error {
+	messages, options, merge, err := marshalRequest(req)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	_, err = s.db.Exec(`INSERT INTO tasks (id, status, tenant, messages, options, merge, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7)`,
+		taskID, StatusQueued, tenant, messages, options, merge, now)
+	if err != nil {
+		return fmt.Errorf("failed to create task in database: %v", err)
+	}
+	return nil
+}
+
+// StartTask marks a task as running on the given worker. Tasks queued
+// without a record (e.g. by the CLI) get one here.
+func (s *SQLStore) StartTask(taskID, workerID, tenant string, req facade.Request) error {
+	messages, options, merge, err := marshalRequest(req)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	return s.inTx("start task", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO tasks (id, status, worker_id, tenant, messages, options, merge, created_at, started_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8, $8)
+			ON CONFLICT (id) DO UPDATE SET status = $2, worker_id = $3, tenant = $4, started_at = $8, updated_at = $8`,
+			taskID, StatusRunning, workerID, tenant, messages, options, merge, now)
+		if err != nil {
+			return err
+		}
+		// A redelivered task starts over
+		_, err = tx.Exec(`DELETE FROM task_responses WHERE task_id = $1`, taskID)
+		return err
+	})
+}
+
+// AddPartialResult records one provider's response, with its latency
+// measured from when the task started
+func (s *SQLStore) AddPartialResult(taskID string, resp facade.ApiResponse) error {
+	now := time.Now().UTC()
+	return s.inTx("store partial result", func(tx *sql.Tx) error {
+		var started sql.NullTime
+		if err := tx.QueryRow(`SELECT started_at FROM tasks WHERE id = $1`, taskID).Scan(&started); err != nil {
+			return err
+		}
+		if err := insertResponse(tx, taskID, resp, started, now); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`UPDATE tasks SET status = $1, updated_at = $2 WHERE id = $3`, StatusPartial, now, taskID)
+		return err
+	})
+}
+
+// StoreResult stores the merged result and marks the task done, or failed
+// when no provider succeeded. Responses not already recorded as partial
+// results are added without a latency.
+func (s *SQLStore) StoreResult(taskID string, result facade.MergedApiResponse) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("marshal error: %v", err)
+	}
+	status, errMsg := StatusDone, ""
+	if !result.AnySucceeded() {
+		status, errMsg = StatusFailed, "all providers failed"
+	}
+	now := time.Now().UTC()
+	return s.inTx("store result", func(tx *sql.Tx) error {
+		res, err := tx.Exec(`UPDATE tasks SET status = $1, result = $2, error = $3, updated_at = $4, completed_at = $4 WHERE id = $5`,
+			status, string(data), errMsg, now, taskID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			_, err = tx.Exec(`INSERT INTO tasks (id, status, result, error, created_at, updated_at, completed_at)
+				VALUES ($1, $2, $3, $4, $5, $5, $5)`,
+				taskID, status, string(data), errMsg, now)
+			if err != nil {
+				return err
+			}
+		}
+		recorded, err := recordedSources(tx, taskID)
+		if err != nil {
+			return err
+		}
+		for _, resp := range result.Results {
+			if recorded[resp.Source] {
+				continue
+			}
+			if err := insertResponse(tx, taskID, resp, sql.NullTime{}, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// FailTask marks a task failed with the given reason
+func (s *SQLStore) FailTask(taskID, reason string) error {
+	now := time.Now().UTC()
+	_, err := s.db.Exec(`INSERT INTO tasks (id, status, error, created_at, updated_at, completed_at)
+		VALUES ($1, $2, $3, $4, $4, $4)
+		ON CONFLICT (id) DO UPDATE SET status = $2, error = $3, updated_at = $4, completed_at = $4`,
+		taskID, StatusFailed, reason, now)
+	if err != nil {
+		return fmt.Errorf("failed to mark task failed in database: %v", err)
+	}
+	return nil
+}
+
+// GetTask returns the task record, or nil if the task is unknown.
+// Responses are reported as Partial only while the task is unfinished.
+func (s *SQLStore) GetTask(taskID string) (*Task, error) {
+	task := &Task{ID: taskID}
+	var result sql.NullString
+	var started, completed sql.NullTime
+	err := s.db.QueryRow(`SELECT status, tenant, worker_id, result, error, created_at, started_at, updated_at, completed_at
+		FROM tasks WHERE id = $1`, taskID).
+		Scan(&task.Status, &task.Tenant, &task.WorkerID, &result, &task.Error, &task.CreatedAt, &started, &task.UpdatedAt, &completed)
+	if err == sql.ErrNoRows {
+		return nil, nil // Not found
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get task from database: %v", err)
+	}
+	if started.Valid {
+		task.StartedAt = &started.Time
+	}
+	if completed.Valid {
+		task.CompletedAt = &completed.Time
+	}
+	if result.Valid {
+		var merged facade.MergedApiResponse
+		if err := json.Unmarshal([]byte(result.String), &merged); err != nil {
+			return nil, fmt.Errorf("unmarshal error: %v", err)
+		}
+		task.Result = &merged
+	}
+	if task.Finished() {
+		return task, nil
+	}
+
+	rows, err := s.db.Query(`SELECT source, message, finish_reason, safety, error, latency_ms, model, input_tokens, output_tokens, cost
+		FROM task_responses WHERE task_id = $1 ORDER BY created_at`, taskID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get responses from database: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var resp facade.ApiResponse
+		var safety sql.NullString
+		var latency, input, output sql.NullInt64
+		var cost sql.NullFloat64
+		if err := rows.Scan(&resp.Source, &resp.Message, &resp.FinishReason, &safety, &resp.Error,
+			&latency, &resp.Model, &input, &output, &cost); err != nil {
+			return nil, fmt.Errorf("failed to read response: %v", err)
+		}
+		resp.LatencyMs = latency.Int64
+		if input.Valid {
+			resp.Usage = &facade.Usage{InputTokens: int(input.Int64), OutputTokens: int(output.Int64), Cost: cost.Float64}
+		}
+		if safety.Valid {
+			if err := json.Unmarshal([]byte(safety.String), &resp.Safety); err != nil {
+				return nil, fmt.Errorf("unmarshal error: %v", err)
+			}
+		}
+		task.Partial = append(task.Partial, resp)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read responses: %v", err)
+	}
+	return task, nil
+}
+
+// ReserveIdempotencyKey maps key to taskID for window, or returns the
+// task ID it already maps to. An expired mapping is replaced.
+func (s *SQLStore) ReserveIdempotencyKey(key, fingerprint, taskID string, window time.Duration) (string, error) {
+	now := time.Now().UTC()
+	var storedFingerprint, existing string
+	err := s.inTx("reserve idempotency key", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO idempotency_keys (idempotency_key, fingerprint, task_id, expires_at)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (idempotency_key) DO UPDATE SET fingerprint = $2, task_id = $3, expires_at = $4
+			WHERE idempotency_keys.expires_at < $5`,
+			key, fingerprint, taskID, now.Add(window), now)
+		if err != nil {
+			return err
+		}
+		return tx.QueryRow(`SELECT fingerprint, task_id FROM idempotency_keys WHERE idempotency_key = $1`, key).
+			Scan(&storedFingerprint, &existing)
+	})
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case existing == taskID:
+		return "", nil // Reserved for us
+	case storedFingerprint != fingerprint:
+		return "", ErrIdempotencyConflict
+	}
+	return existing, nil
+}
+
+// ReleaseIdempotencyKey forgets key
+func (s *SQLStore) ReleaseIdempotencyKey(key string) error {
+	if _, err := s.db.Exec(`DELETE FROM idempotency_keys WHERE idempotency_key = $1`, key); err != nil {
+		return fmt.Errorf("failed to release idempotency key in database: %v", err)
+	}
+	return nil
+}
+
+// Close closes the database
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+// inTx runs fn in a transaction, describing failures as action
+func (s *SQLStore) inTx(action string, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to %s in database: %v", action, err)
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to %s in database: %v", action, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to %s in database: %v", action, err)
+	}
+	return nil
+}
+
+// recordedSources returns the providers that already have a response for taskID
+func recordedSources(tx *sql.Tx, taskID string) (map[string]bool, error) {
+	rows, err := tx.Query(`SELECT source FROM task_responses WHERE task_id = $1`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	sources := make(map[string]bool)
+	for rows.Next() {
+		var source string
+		if err := rows.Scan(&source); err != nil {
+			return nil, err
+		}
+		sources[source] = true
+	}
+	return sources, rows.Err()
+}
+
+// insertResponse records resp, replacing an earlier row from the same
+// source. Its latency is the facade's measurement if it has one, or else
+// the time since the task started. Token counts and cost are NULL when the
+// provider reported no usage.
+func insertResponse(tx *sql.Tx, taskID string, resp facade.ApiResponse, started sql.NullTime, now time.Time) error {
+	var latency sql.NullInt64
+	if resp.LatencyMs > 0 {
+		latency = sql.NullInt64{Int64: resp.LatencyMs, Valid: true}
+	} else if started.Valid {
+		latency = sql.NullInt64{Int64: now.Sub(started.Time).Milliseconds(), Valid: true}
+	}
+	if _, err := tx.Exec(`DELETE FROM task_responses WHERE task_id = $1 AND source = $2`, taskID, resp.Source); err != nil {
+		return err
+	}
+	var input, output sql.NullInt64
+	var cost sql.NullFloat64
+	if u := resp.Usage; u != nil {
+		input = sql.NullInt64{Int64: int64(u.InputTokens), Valid: true}
+		output = sql.NullInt64{Int64: int64(u.OutputTokens), Valid: true}
+		cost = sql.NullFloat64{Float64: u.Cost, Valid: true}
+	}
+	_, err := tx.Exec(`INSERT INTO task_responses (task_id, source, message, finish_reason, safety, error, latency_ms,
+			model, input_tokens, output_tokens, cost, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		taskID, resp.Source, resp.Message, resp.FinishReason, marshalSafety(resp), resp.Error, latency,
+		resp.Model, input, output, cost, now)
+	return err
+}
+
+// marshalRequest encodes the parts of a request that are stored as JSON
+func marshalRequest(req facade.Request) (messages, options, merge string, err error) {
+	var data [3][]byte
+	for i, v := range []interface{}{req.Messages, req.Options, req.Merge} {
+		if data[i], err = json.Marshal(v); err != nil {
+			return "", "", "", fmt.Errorf("marshal error: %v", err)
+		}
+	}
+	return string(data[0]), string(data[1]), string(data[2]), nil
+}
+
+// marshalSafety encodes a response's safety block, or NULL if it has none
+func marshalSafety(resp facade.ApiResponse) sql.NullString {
+	if resp.Safety == nil {
+		return sql.NullString{}
+	}
+	data, err := json.Marshal(resp.Safety)
+	if err != nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(data), Valid: true}
+}
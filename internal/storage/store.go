@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/facade"
+)
+
+// Result store backends selectable with RESULT_STORE
+const (
+	StoreRedis = "redis" // Expiring task records; the default
+	StoreSQL   = "sql"   // Long-term history in SQLite or Postgres
+)
+
+// ErrIdempotencyConflict is returned when an idempotency key is reused
+// for a request that differs from the one it was first used for
+var ErrIdempotencyConflict = errors.New("idempotency key was already used for a different request")
+
+// ResultStore records tasks through their lifecycle
+type ResultStore interface {
+	// CreateTask records a newly queued task, the tenant that owns it and
+	// its request
+	CreateTask(taskID, tenant string, req facade.Request) error
+	// StartTask marks a task as running on the given worker, creating
+	// the record for tasks queued without one, and discards partial
+	// results from earlier deliveries
+	StartTask(taskID, workerID, tenant string, req facade.Request) error
+	// AddPartialResult records one provider's result and marks the task partial
+	AddPartialResult(taskID string, resp facade.ApiResponse) error
+	// StoreResult stores the merged result and marks the task done, or
+	// failed when no provider succeeded
+	StoreResult(taskID string, result facade.MergedApiResponse) error
+	// FailTask marks a task failed with the given reason
+	FailTask(taskID, reason string) error
+	// GetTask returns the task record, or nil if the task is unknown
+	GetTask(taskID string) (*Task, error)
+	// ReserveIdempotencyKey maps key to taskID for window. If the key is
+	// already mapped it returns the existing task ID instead, or
+	// ErrIdempotencyConflict when fingerprint shows a different request.
+	ReserveIdempotencyKey(key, fingerprint, taskID string, window time.Duration) (existing string, err error)
+	// ReleaseIdempotencyKey forgets key, e.g. when its task failed to enqueue
+	ReleaseIdempotencyKey(key string) error
+	KeyStore
+	UsageStore
+	Close() error
+}
+
+// NewResultStore opens the result store selected in cfg
+func NewResultStore(cfg *facade.Config) (ResultStore, error) {
+	switch cfg.ResultStore {
+	case StoreRedis:
+		return NewRedisClient(cfg.Redis_URL, cfg.TaskTTL)
+	case StoreSQL:
+		return NewSQLStore(cfg.SQLDriver, cfg.SQLDSN)
+	}
+	return nil, fmt.Errorf("unknown result store %q", cfg.ResultStore)
+}
@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/facade"
+)
+
+// Task statuses, in lifecycle order. Done and failed are terminal.
+const (
+	StatusQueued  = "queued"  // Published by the api_server, not yet picked up
+	StatusRunning = "running" // A worker is calling providers
+	StatusPartial = "partial" // Some provider results have arrived
+	StatusDone    = "done"    // Merged result stored
+	StatusFailed  = "failed"  // Task could not be processed, or every provider failed
+)
+
+// Task is the stored record of a submitted task
+type Task struct {
+	ID          string                    `json:"id"`
+	Status      string                    `json:"status"`
+	Tenant      string                    `json:"tenant,omitempty"` // Owner; empty for tasks queued by the CLI
+	WorkerID    string                    `json:"worker_id,omitempty"`
+	Partial     []facade.ApiResponse      `json:"partial,omitempty"` // Provider results received so far
+	Result      *facade.MergedApiResponse `json:"result,omitempty"`
+	Error       string                    `json:"error,omitempty"`
+	CreatedAt   time.Time                 `json:"created_at"`
+	StartedAt   *time.Time                `json:"started_at,omitempty"`
+	UpdatedAt   time.Time                 `json:"updated_at"`
+	CompletedAt *time.Time                `json:"completed_at,omitempty"`
+}
+
+// Finished reports whether the task reached a terminal status
+func (t *Task) Finished() bool {
+	return t.Status == StatusDone || t.Status == StatusFailed
+}
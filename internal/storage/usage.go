@@ -0,0 +1,248 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/facade"
+	"github.com/redis/go-redis/v9"
+)
+
+// UsageRetention is how long Redis keeps daily usage totals
+const UsageRetention = 400 * 24 * time.Hour
+
+// UsageRecord is one tenant's usage of one provider and model on one UTC day
+type UsageRecord struct {
+	Tenant   string `json:"tenant"`
+	Day      string `json:"day"` // YYYY-MM-DD
+	Source   string `json:"source"`
+	Model    string `json:"model,omitempty"`
+	Requests int    `json:"requests"`
+	facade.Usage
+}
+
+// UsageStore aggregates token usage and cost per tenant, day, provider
+// and model
+type UsageStore interface {
+	// RecordUsage adds the provider calls behind result, the judge's
+	// and late answers included, to tenant's usage for today
+	RecordUsage(tenant string, result facade.MergedApiResponse) error
+	// GetUsage returns tenant's usage on each UTC day from from to to
+	// inclusive, or every tenant's when tenant is empty
+	GetUsage(tenant string, from, to time.Time) ([]UsageRecord, error)
+}
+
+// usageRecords turns the calls behind result into records for tenant on
+// day. Calls that failed without reporting usage cost nothing and are left
+// out.
+func usageRecords(tenant, day string, result facade.MergedApiResponse) []UsageRecord {
+	var records []UsageRecord
+	for _, r := range result.Calls() {
+		if r.Usage == nil && r.Error != "" {
+			continue
+		}
+		record := UsageRecord{Tenant: tenant, Day: day, Source: r.Source, Model: r.Model, Requests: 1}
+		if r.Usage != nil {
+			record.Usage = *r.Usage
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// Usage lives in one hash per tenant and day at usage:<tenant>:<day>, with
+// a field per source, model and counter; the set usage:tenants lists every
+// tenant with usage
+func usageKey(tenant, day string) string {
+	return "usage:" + tenant + ":" + day
+}
+
+const usageTenantsSet = "usage:tenants"
+
+// usageField names the counter of one source and model. Model names may
+// contain most punctuation, so the counter is split off at the last "|".
+func usageField(source, model, counter string) string {
+	return source + "|" + model + "|" + counter
+}
+
+// RecordUsage adds the provider calls behind result to tenant's usage for today
+func (r *RedisClient) RecordUsage(tenant string, result facade.MergedApiResponse) error {
+	records := usageRecords(tenant, time.Now().UTC().Format(time.DateOnly), result)
+	if len(records) == 0 {
+		return nil
+	}
+	_, err := r.client.TxPipelined(r.ctx, func(pipe redis.Pipeliner) error {
+		key := usageKey(tenant, records[0].Day)
+		for _, u := range records {
+			pipe.HIncrBy(r.ctx, key, usageField(u.Source, u.Model, "requests"), int64(u.Requests))
+			pipe.HIncrBy(r.ctx, key, usageField(u.Source, u.Model, "input_tokens"), int64(u.InputTokens))
+			pipe.HIncrBy(r.ctx, key, usageField(u.Source, u.Model, "output_tokens"), int64(u.OutputTokens))
+			pipe.HIncrByFloat(r.ctx, key, usageField(u.Source, u.Model, "cost"), u.Cost)
+		}
+		pipe.Expire(r.ctx, key, UsageRetention)
+		pipe.SAdd(r.ctx, usageTenantsSet, tenant)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record usage in Redis: %v", err)
+	}
+	return nil
+}
+
+// GetUsage returns tenant's usage on each UTC day from from to to
+// inclusive, or every tenant's when tenant is empty
+func (r *RedisClient) GetUsage(tenant string, from, to time.Time) ([]UsageRecord, error) {
+	tenants := []string{tenant}
+	if tenant == "" {
+		var err error
+		if tenants, err = r.client.SMembers(r.ctx, usageTenantsSet).Result(); err != nil {
+			return nil, fmt.Errorf("failed to get usage from Redis: %v", err)
+		}
+		sort.Strings(tenants)
+	}
+	var records []UsageRecord
+	for day := from.UTC(); !day.After(to.UTC()); day = day.AddDate(0, 0, 1) {
+		date := day.Format(time.DateOnly)
+		for _, t := range tenants {
+			h, err := r.client.HGetAll(r.ctx, usageKey(t, date)).Result()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get usage from Redis: %v", err)
+			}
+			records = append(records, parseUsageHash(t, date, h)...)
+		}
+	}
+	return records, nil
+}
+
+// parseUsageHash turns one usage hash back into records, sorted by source
+// and model
+func parseUsageHash(tenant, day string, h map[string]string) []UsageRecord {
+	bySeries := make(map[string]*UsageRecord)
+	var series []string
+	for field, value := range h {
+		i := strings.LastIndex(field, "|")
+		if i < 0 {
+			continue
+		}
+		source, model, ok := strings.Cut(field[:i], "|")
+		if !ok {
+			continue
+		}
+		name := source + "|" + model
+		u := bySeries[name]
+		if u == nil {
+			u = &UsageRecord{Tenant: tenant, Day: day, Source: source, Model: model}
+			bySeries[name] = u
+			series = append(series, name)
+		}
+		switch field[i+1:] {
+		case "requests":
+			u.Requests, _ = strconv.Atoi(value)
+		case "input_tokens":
+			u.InputTokens, _ = strconv.Atoi(value)
+		case "output_tokens":
+			u.OutputTokens, _ = strconv.Atoi(value)
+		case "cost":
+			u.Cost, _ = strconv.ParseFloat(value, 64)
+		}
+	}
+	sort.Strings(series)
+	records := make([]UsageRecord, len(series))
+	for i, name := range series {
+		records[i] = *bySeries[name]
+	}
+	return records
+}
+
+// RecordUsage adds the provider calls behind result to tenant's usage for today
+func (s *SQLStore) RecordUsage(tenant string, result facade.MergedApiResponse) error {
+	records := usageRecords(tenant, time.Now().UTC().Format(time.DateOnly), result)
+	if len(records) == 0 {
+		return nil
+	}
+	return s.inTx("record usage", func(tx *sql.Tx) error {
+		for _, u := range records {
+			_, err := tx.Exec(`INSERT INTO usage_daily (tenant, day, source, model, requests, input_tokens, output_tokens, cost)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+				ON CONFLICT (tenant, day, source, model) DO UPDATE SET
+					requests = usage_daily.requests + excluded.requests,
+					input_tokens = usage_daily.input_tokens + excluded.input_tokens,
+					output_tokens = usage_daily.output_tokens + excluded.output_tokens,
+					cost = usage_daily.cost + excluded.cost`,
+				u.Tenant, u.Day, u.Source, u.Model, u.Requests, u.InputTokens, u.OutputTokens, u.Cost)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetUsage returns tenant's usage on each UTC day from from to to
+// inclusive, or every tenant's when tenant is empty
+func (s *SQLStore) GetUsage(tenant string, from, to time.Time) ([]UsageRecord, error) {
+	query := `SELECT tenant, day, source, model, requests, input_tokens, output_tokens, cost
+		FROM usage_daily WHERE day >= $1 AND day <= $2`
+	args := []interface{}{from.UTC().Format(time.DateOnly), to.UTC().Format(time.DateOnly)}
+	if tenant != "" {
+		query += ` AND tenant = $3`
+		args = append(args, tenant)
+	}
+	rows, err := s.db.Query(query+` ORDER BY day, tenant, source, model`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage from database: %v", err)
+	}
+	defer rows.Close()
+	var records []UsageRecord
+	for rows.Next() {
+		var u UsageRecord
+		if err := rows.Scan(&u.Tenant, &u.Day, &u.Source, &u.Model, &u.Requests, &u.InputTokens, &u.OutputTokens, &u.Cost); err != nil {
+			return nil, fmt.Errorf("failed to read usage: %v", err)
+		}
+		records = append(records, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read usage: %v", err)
+	}
+	return records, nil
+}
+
+// ParseUsageRange parses from and to as YYYY-MM-DD days. From defaults to
+// the first day of the current UTC month and to defaults to today.
+func ParseUsageRange(from, to string) (time.Time, time.Time, error) {
+	now := time.Now().UTC()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	var err error
+	if from != "" {
+		if start, err = time.Parse(time.DateOnly, from); err != nil {
+			return start, end, fmt.Errorf("invalid from %q, want YYYY-MM-DD", from)
+		}
+	}
+	if to != "" {
+		if end, err = time.Parse(time.DateOnly, to); err != nil {
+			return start, end, fmt.Errorf("invalid to %q, want YYYY-MM-DD", to)
+		}
+	}
+	if end.Before(start) {
+		return start, end, fmt.Errorf("from %s is after to %s", start.Format(time.DateOnly), end.Format(time.DateOnly))
+	}
+	if end.Sub(start) > UsageRetention {
+		return start, end, fmt.Errorf("range exceeds %d days", int(UsageRetention.Hours()/24))
+	}
+	return start, end, nil
+}
+
+// SumUsage adds up records into one with only Requests and Usage set
+func SumUsage(records []UsageRecord) UsageRecord {
+	var total UsageRecord
+	for _, u := range records {
+		total.Requests += u.Requests
+		total.Usage.Add(u.Usage)
+	}
+	return total
+}
@@ -0,0 +1,154 @@
+package worker
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// callbackTimeout bounds one callback POST
+const callbackTimeout = 10 * time.Second
+
+// Callback signature headers. The signature is "sha256=" followed by the
+// hex HMAC-SHA256, keyed with CALLBACK_SECRET, of "<timestamp>.<body>".
+const (
+	timestampHeader = "X-Callback-Timestamp"
+	signatureHeader = "X-Callback-Signature"
+)
+
+// errForbiddenAddress is returned for callbacks to addresses inside the
+// deployment: loopback, private networks, link-local and cloud metadata
+var errForbiddenAddress = errors.New("callback address is not public")
+
+// blockedPrefixes are non-public ranges netip.Addr has no predicate for
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // Carrier-grade NAT
+}
+
+// callbackClient delivers callbacks directly, never through a proxy, and
+// refuses to connect to non-public addresses. The check runs on each
+// address actually dialled, so redirects and hostnames that resolve, or
+// later re-resolve, to an internal address are refused as well.
+var callbackClient = &http.Client{
+	Timeout: callbackTimeout,
+	Transport: &http.Transport{
+		Proxy:               nil,
+		DialContext:         (&net.Dialer{Timeout: callbackTimeout, Control: dialControl}).DialContext,
+		TLSHandshakeTimeout: callbackTimeout,
+		MaxIdleConns:        10,
+		IdleConnTimeout:     90 * time.Second,
+	},
+}
+
+// publicAddr reports whether callbacks may be delivered to addr
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, p := range blockedPrefixes {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// dialControl is a net.Dialer Control func that refuses non-public addresses
+func dialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !publicAddr(addr) {
+		return fmt.Errorf("%w: %s", errForbiddenAddress, host)
+	}
+	return nil
+}
+
+// CheckCallback checks that raw is an absolute http or https URL that does
+// not name localhost or a non-public IP address. Hostnames are checked
+// again against the addresses they resolve to on every delivery.
+func CheckCallback(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("must be an absolute http or https URL")
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return errForbiddenAddress
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && !publicAddr(addr) {
+		return errForbiddenAddress
+	}
+	return nil
+}
+
+// notify POSTs the stored task record to the task's callback URL. It is
+// best effort: the result is already stored, so failures are only logged.
+func (w *Worker) notify(callback, taskID string) {
+	if err := w.postTask(callback, taskID); err != nil {
+		log.Printf("Callback for task %s to %s failed: %v", taskID, callback, err)
+	}
+}
+
+// postTask sends the task record to callback as JSON, signed when a
+// callback secret is configured
+func (w *Worker) postTask(callback, taskID string) error {
+	task, err := w.store.GetTask(taskID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch task: %v", err)
+	}
+	if task == nil {
+		return fmt.Errorf("task not found")
+	}
+	body, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, callback, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.callbackSecret != "" {
+		signCallback(req.Header, w.callbackSecret, body, time.Now())
+	}
+	resp, err := callbackClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("callback returned %s", resp.Status)
+	}
+	return nil
+}
+
+// signCallback sets the timestamp and signature headers for body. Signing
+// the timestamp lets receivers reject replays of old deliveries.
+func signCallback(h http.Header, secret string, body []byte, now time.Time) {
+	ts := strconv.FormatInt(now.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	h.Set(timestampHeader, ts)
+	h.Set(signatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+}
@@ -0,0 +1,72 @@
+package worker
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckCallback(t *testing.T) {
+	for _, tc := range []struct {
+		url string
+		ok  bool
+	}{
+		{"https://hooks.example.com/done", true},
+		{"http://93.184.216.34:8080/cb", true},
+		{"ftp://example.com/cb", false},
+		{"/relative", false},
+		{"http://localhost:9000/cb", false},
+		{"http://api.localhost/cb", false},
+		{"http://127.0.0.1/cb", false},
+		{"http://10.1.2.3/cb", false},
+		{"http://192.168.0.10/cb", false},
+		{"http://169.254.169.254/latest/meta-data/", false},
+		{"http://100.64.0.1/cb", false},
+		{"http://0.0.0.0/cb", false},
+		{"http://[::1]/cb", false},
+		{"http://[fd00::1]/cb", false},
+		{"http://[::ffff:127.0.0.1]/cb", false},
+	} {
+		err := CheckCallback(tc.url)
+		if (err == nil) != tc.ok {
+			t.Errorf("CheckCallback(%q) = %v, want ok=%v", tc.url, err, tc.ok)
+		}
+	}
+}
+
+func TestCallbackClientRefusesLoopback(t *testing.T) {
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+
+	_, err := callbackClient.Post(srv.URL, "application/json", strings.NewReader("{}"))
+	if !errors.Is(err, errForbiddenAddress) {
+		t.Fatalf("Post to %s: got %v, want errForbiddenAddress", srv.URL, err)
+	}
+	if called {
+		t.Fatal("callback reached the loopback server")
+	}
+}
+
+func TestSignCallback(t *testing.T) {
+	body := []byte(`{"id":"t1"}`)
+	h := http.Header{}
+	signCallback(h, "s3cret", body, time.Unix(1700000000, 0))
+
+	if got := h.Get(timestampHeader); got != "1700000000" {
+		t.Fatalf("timestamp = %q", got)
+	}
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte("1700000000." + string(body)))
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); h.Get(signatureHeader) != want {
+		t.Fatalf("signature = %q, want %q", h.Get(signatureHeader), want)
+	}
+}
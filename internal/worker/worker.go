@@ -0,0 +1,235 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/budget"
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/facade"
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/queue"
+	"github.com/Rammurthy5/ai_agents_wrapper/internal/storage"
+)
+
+// Worker processes queued tasks on a fixed number of goroutines
+type Worker struct {
+	id              string
+	f               *facade.Facade
+	broker          queue.Broker
+	store           storage.ResultStore
+	events          *storage.RedisClient // Publishes live progress
+	budget          *budget.Guard        // Spend budgets checked before each task fans out
+	callbackSecret  string               // Key for callback signatures; empty sends them unsigned
+	concurrency     int
+	shutdownTimeout time.Duration
+}
+
+// New creates a worker identified as id, sized from cfg
+func New(id string, f *facade.Facade, broker queue.Broker, store storage.ResultStore, events *storage.RedisClient, guard *budget.Guard, cfg *facade.Config) *Worker {
+	concurrency := cfg.WorkerConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	return &Worker{
+		id:              id,
+		f:               f,
+		broker:          broker,
+		store:           store,
+		events:          events,
+		budget:          guard,
+		callbackSecret:  cfg.CallbackSecret,
+		concurrency:     concurrency,
+		shutdownTimeout: cfg.ShutdownTimeout,
+	}
+}
+
+// Run consumes tasks until ctx is cancelled, then stops consuming and
+// waits up to the shutdown timeout for in-flight tasks. Tasks still
+// running after that are abandoned and put back on the queue.
+func (w *Worker) Run(ctx context.Context) error {
+	// Cancelled only when in-flight tasks overrun the shutdown timeout
+	taskCtx, cancelTasks := context.WithCancel(context.Background())
+	defer cancelTasks()
+
+	msgs, err := w.broker.Consume(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to consume from queue: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < w.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for msg := range msgs {
+				if ctx.Err() != nil {
+					// Prefetched after shutdown began; leave it for another worker
+					if err := msg.Release(); err != nil {
+						log.Printf("Failed to requeue message: %v", err)
+					}
+					continue
+				}
+				w.handle(taskCtx, msg)
+			}
+		}()
+	}
+	drained := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(drained)
+	}()
+
+	fmt.Printf("Worker started with %d task slots. Consuming from queue..\n", w.concurrency)
+	select {
+	case <-drained:
+		fmt.Println("Queue closed, worker stopping")
+		return nil
+	case <-ctx.Done():
+	}
+	fmt.Printf("Worker shutting down, waiting up to %v for in-flight tasks\n", w.shutdownTimeout)
+	select {
+	case <-drained:
+	case <-time.After(w.shutdownTimeout):
+		log.Printf("Shutdown timeout exceeded, requeueing in-flight tasks")
+		cancelTasks()
+		<-drained
+	}
+	fmt.Println("Worker stopped")
+	return nil
+}
+
+// handle processes one delivery and settles it. Cancelling ctx abandons
+// the task and puts it back on the queue.
+func (w *Worker) handle(ctx context.Context, msg queue.Delivery) {
+	var task queue.Message
+	if err := json.Unmarshal(msg.Body(), &task); err != nil {
+		log.Printf("Failed to unmarshal message: %v", err)
+		w.deadLetter(msg, fmt.Sprintf("unparseable message: %v", err))
+		return
+	}
+	req := task.Request()
+	if err := req.Validate(); err != nil {
+		log.Printf("Invalid task %s: %v", task.TaskID, err)
+		reason := fmt.Sprintf("invalid request: %v", err)
+		w.failTask(task.TaskID, reason)
+		w.deadLetter(msg, reason)
+		return
+	}
+	if err := w.store.StartTask(task.TaskID, w.id, task.Tenant, req); err != nil {
+		log.Printf("Failed to mark task %s running: %v", task.TaskID, err)
+	}
+	req, err := w.budget.Check(w.f, task.Tenant, req)
+	if errors.Is(err, facade.ErrOverBudget) {
+		log.Printf("Refused task %s: %v", task.TaskID, err)
+		w.failTask(task.TaskID, err.Error())
+		if err := msg.Ack(); err != nil {
+			log.Printf("Failed to ack task %s: %v", task.TaskID, err)
+		}
+		if task.Callback != "" {
+			w.notify(task.Callback, task.TaskID)
+		}
+		return
+	}
+	if err != nil {
+		w.retry(msg, task.TaskID, fmt.Sprintf("failed to check budget: %v", err))
+		return
+	}
+	log.Printf("Processing task %s with %d messages", task.TaskID, len(req.Messages))
+	// process the conversation, publishing progress for SSE subscribers
+	result := w.runTask(ctx, task.TaskID, req, task.Stream)
+	if ctx.Err() != nil {
+		log.Printf("Abandoned task %s: worker shutting down", task.TaskID)
+		if err := msg.Release(); err != nil {
+			log.Printf("Failed to requeue task %s: %v", task.TaskID, err)
+		}
+		return
+	}
+	if err := w.store.StoreResult(task.TaskID, result); err != nil {
+		log.Printf("Failed to store result for task %s: %v", task.TaskID, err)
+		w.retry(msg, task.TaskID, fmt.Sprintf("failed to store result: %v", err))
+		return
+	}
+	if err := w.store.RecordUsage(task.Tenant, result); err != nil {
+		log.Printf("Failed to record usage for task %s: %v", task.TaskID, err)
+	}
+	w.budget.Record(task.Tenant, result.Usage.Cost)
+	// Only acknowledge once the result is safely stored
+	if err := msg.Ack(); err != nil {
+		log.Printf("Failed to ack task %s: %v", task.TaskID, err)
+	}
+	log.Printf("Stored result for task %s", task.TaskID)
+	final := storage.TaskEvent{Type: storage.EventDone, TaskID: task.TaskID, Merged: &result}
+	if !result.AnySucceeded() {
+		final.Type, final.Error = storage.EventFailed, "all providers failed"
+	}
+	w.publish(final)
+	if task.Callback != "" {
+		w.notify(task.Callback, task.TaskID)
+	}
+}
+
+// runTask processes one request, publishing each provider's result as it
+// completes, plus token deltas when stream is set
+func (w *Worker) runTask(ctx context.Context, taskID string, req facade.Request, stream bool) facade.MergedApiResponse {
+	onResult := func(resp facade.ApiResponse) {
+		if err := w.store.AddPartialResult(taskID, resp); err != nil {
+			log.Printf("Failed to store partial result for task %s: %v", taskID, err)
+		}
+		w.publish(storage.TaskEvent{Type: storage.EventResult, TaskID: taskID, Source: resp.Source, Result: &resp})
+	}
+	if !stream {
+		return w.f.GetMergedResultsWithProgress(ctx, req, onResult)
+	}
+
+	var results []facade.ApiResponse
+	for ev := range w.f.Stream(ctx, req) {
+		switch {
+		case ev.Done:
+			results = append(results, *ev.Response)
+			onResult(*ev.Response)
+		case ev.Delta != "":
+			w.publish(storage.TaskEvent{Type: storage.EventDelta, TaskID: taskID, Source: ev.Source, Delta: ev.Delta})
+		}
+	}
+	return w.f.Merge(ctx, req, results)
+}
+
+// retry requeues a failed delivery, failing its task once the delivery
+// count is exhausted and the message has been dead-lettered
+func (w *Worker) retry(msg queue.Delivery, taskID, reason string) {
+	deadLettered, err := msg.Retry(reason)
+	if err != nil {
+		log.Printf("Failed to requeue task %s: %v", taskID, err)
+		return
+	}
+	if deadLettered {
+		log.Printf("Dead-lettered task %s: %s", taskID, reason)
+		w.failTask(taskID, reason)
+	}
+}
+
+// deadLetter parks a message that can never succeed on the dead-letter queue
+func (w *Worker) deadLetter(msg queue.Delivery, reason string) {
+	if err := msg.DeadLetter(reason); err != nil {
+		log.Printf("Failed to dead-letter message: %v", err)
+	}
+}
+
+// failTask records a task as failed and tells subscribers
+func (w *Worker) failTask(taskID, reason string) {
+	if err := w.store.FailTask(taskID, reason); err != nil {
+		log.Printf("Failed to mark task %s failed: %v", taskID, err)
+	}
+	w.publish(storage.TaskEvent{Type: storage.EventFailed, TaskID: taskID, Error: reason})
+}
+
+// publish sends a progress event; failures only cost live updates, so they are logged
+func (w *Worker) publish(ev storage.TaskEvent) {
+	if err := w.events.PublishEvent(ev); err != nil {
+		log.Printf("Failed to publish %s event for task %s: %v", ev.Type, ev.TaskID, err)
+	}
+}